@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// slowResponseFactor is how many times slower than the fastest response a
+// response must be to suggest the server is falling behind.
+const slowResponseFactor = 10
+
+// adaptiveLimiter bounds concurrent requests like Config.MaxInFlight, but
+// with a limit that adapts to the server, for Config.AdaptiveConcurrency.
+// It halves the limit when the server asks to slow down, and raises it by
+// one for every limit's worth of healthy responses.
+type adaptiveLimiter struct {
+	max    float64
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	// decreased is when the limit was last halved. Requests sent before
+	// then were sent at a higher concurrency, so they do not halve it again.
+	decreased time.Time
+	// fastest is the shortest response time seen.
+	fastest time.Duration
+	// freed is closed, and replaced, when a request may start.
+	freed chan struct{}
+}
+
+func newAdaptiveLimiter(limit int, logger *slog.Logger) *adaptiveLimiter {
+	return &adaptiveLimiter{max: float64(limit), logger: logger, limit: float64(limit), freed: make(chan struct{})}
+}
+
+// acquire waits until a request may start, or ctx is done. The returned
+// release func must be called exactly once, when the request is over.
+func (l *adaptiveLimiter) acquire(ctx context.Context) (release func(), err error) {
+	for {
+		l.mu.Lock()
+		if l.inFlight < max(1, int(l.limit)) {
+			l.inFlight++
+			l.mu.Unlock()
+			return l.release, nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// notify wakes the requests waiting in acquire. l.mu must be held.
+func (l *adaptiveLimiter) notify() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// observe adjusts the limit to the outcome of a request sent at start.
+func (l *adaptiveLimiter) observe(start time.Time, resp *http.Response, err error) {
+	if l == nil || err != nil {
+		return
+	}
+	elapsed := time.Since(start)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		if start.After(l.decreased) {
+			l.limit = max(1, l.limit/2)
+			l.decreased = time.Now()
+			l.logger.Info(fmt.Sprintf("Got status %d, lowering concurrency to %d", resp.StatusCode, int(l.limit)))
+		}
+	case resp.StatusCode < http.StatusInternalServerError:
+		if l.fastest == 0 || elapsed < l.fastest {
+			l.fastest = elapsed
+		}
+		if elapsed <= slowResponseFactor*l.fastest && l.limit < l.max {
+			l.limit = min(l.max, l.limit+1/l.limit)
+			l.notify()
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartScraper_AdaptiveConcurrency(t *testing.T) {
+	const capacity = 4
+	const pages = 120
+	var inFlight atomic.Int32
+	var mu sync.Mutex
+	var limited []bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if r.URL.Path == "/" {
+			var sb strings.Builder
+			for i := range pages {
+				fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+			}
+			fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+			return
+		}
+		mu.Lock()
+		limited = append(limited, n > capacity)
+		mu.Unlock()
+		if n > capacity {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, "<html><body>Page</body></html>")
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 16
+	cfg.AdaptiveConcurrency = true
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(limited) != pages {
+		t.Fatalf("Expected %d requests, got %d", pages, len(limited))
+	}
+	// Once settled, the concurrency only goes over the capacity of the
+	// server when probing for more.
+	rejected := 0
+	for _, l := range limited[pages/2:] {
+		if l {
+			rejected++
+		}
+	}
+	if rejected > pages/8 {
+		t.Errorf("Expected the concurrency to settle below %d, got %d of the last %d requests rejected", capacity, rejected, pages/2)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// tokenSource caches the bearer token given by Config.TokenProvider, and
+// shares it among workers.
+type tokenSource struct {
+	provider func(ctx context.Context) (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+func newTokenSource(provider func(ctx context.Context) (string, error)) *tokenSource {
+	return &tokenSource{provider: provider}
+}
+
+// get returns the current token, asking the provider for one if there is
+// none yet.
+func (t *tokenSource) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" {
+		return t.fetch(ctx)
+	}
+	return t.token, nil
+}
+
+// refresh returns a new token to replace rejected. Workers rejected with the
+// same token only ask the provider for a new one once.
+func (t *tokenSource) refresh(ctx context.Context, rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != rejected {
+		return t.token, nil
+	}
+	return t.fetch(ctx)
+}
+
+// fetch asks the provider for a token. t.mu must be held.
+func (t *tokenSource) fetch(ctx context.Context) (string, error) {
+	token, err := t.provider(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
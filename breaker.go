@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops requests to a host for a while after it failed too
+// many times in a row.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*breakerState
+}
+
+type breakerState struct {
+	// failures counts consecutive failures. It is only reset by a success,
+	// so a single failure after a cooldown opens the breaker again.
+	failures int
+	// openUntil is when requests to the host may resume.
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, logger *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+		hosts:     make(map[string]*breakerState),
+	}
+}
+
+// wait blocks while the breaker of host is open, or until ctx is done.
+func (b *circuitBreaker) wait(ctx context.Context, host string) error {
+	if b == nil {
+		return ctx.Err()
+	}
+	b.mu.Lock()
+	var openUntil time.Time
+	if state, ok := b.hosts[host]; ok {
+		openUntil = state.openUntil
+	}
+	b.mu.Unlock()
+	return sleep(ctx, time.Until(openUntil))
+}
+
+// record notes the outcome of a request to host, opening its breaker once
+// failures reach the threshold.
+func (b *circuitBreaker) record(host string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.hosts[host]
+	if !ok {
+		state = &breakerState{}
+		b.hosts[host] = state
+	}
+	if !failed {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	if state.failures >= b.threshold && time.Now().After(state.openUntil) {
+		state.openUntil = time.Now().Add(b.cooldown)
+		b.logger.Warn(fmt.Sprintf("%s failed %d times in a row, pausing requests to it for %s", host, state.failures, b.cooldown))
+	}
+}
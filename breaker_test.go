@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartScraper_CircuitBreaker(t *testing.T) {
+	// The outage host fails every request.
+	var mu sync.Mutex
+	var failedAt []time.Time
+	outage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failedAt = append(failedAt, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer outage.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var sb strings.Builder
+		for i := range 4 {
+			fmt.Fprintf(&sb, `<a href="%s/%d">%d</a>`, outage.URL, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	const cooldown = 300 * time.Millisecond
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	cfg.CircuitBreakerThreshold = 2
+	cfg.CircuitBreakerCooldown = cooldown
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 4 {
+		t.Errorf("Expected every pending URL to still be checked, got: %v", deadLinks)
+	}
+
+	if len(failedAt) != 4 {
+		t.Fatalf("Expected 4 requests to the failing host, got %d", len(failedAt))
+	}
+	// The breaker opens after the second failure, and again after the
+	// third since failures are only reset by a success.
+	for i, gap := range []time.Duration{failedAt[2].Sub(failedAt[1]), failedAt[3].Sub(failedAt[2])} {
+		if gap < cooldown {
+			t.Errorf("Expected request %d to wait for the cooldown, waited %s", i+3, gap)
+		}
+	}
+	if gap := failedAt[1].Sub(failedAt[0]); gap >= cooldown {
+		t.Errorf("Expected no pause before the threshold is reached, waited %s", gap)
+	}
+}
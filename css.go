@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// cssURLs returns the URLs referenced by url() in a stylesheet, quoted or
+// not, in order. Comments, data: URIs and references to SVG fragments, as in
+// url(#clip), are skipped.
+func cssURLs(css string) []string {
+	var urls []string
+	for css != "" {
+		if strings.HasPrefix(css, "/*") {
+			end := strings.Index(css[2:], "*/")
+			if end < 0 {
+				break
+			}
+			css = css[2+end+2:]
+			continue
+		}
+		if len(css) < 4 || !strings.EqualFold(css[:4], "url(") {
+			css = css[1:]
+			continue
+		}
+
+		rest := strings.TrimLeft(css[4:], " \t\n\r\f")
+		var ref string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				break
+			}
+			ref, rest = rest[1:1+end], rest[1+end+1:]
+		} else {
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				break
+			}
+			ref, rest = strings.TrimRight(rest[:end], " \t\n\r\f"), rest[end:]
+		}
+		css = rest
+		if ref == "" || ref[0] == '#' || len(ref) >= 5 && strings.EqualFold(ref[:5], "data:") {
+			continue
+		}
+		urls = append(urls, ref)
+	}
+	return urls
+}
+
+// cssLinks returns the assets referenced by the stylesheet in body,
+// resolved against its URL.
+func cssLinks(body io.Reader, base *url.URL, logger *slog.Logger) ([]link, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var links []link
+	for _, ref := range cssURLs(string(content)) {
+		clean, err := cleanURL(ref, base)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to clean URL: %s", err.Error()))
+			continue
+		}
+		links = append(links, link{url: clean, rel: "css"})
+	}
+	return links, nil
+}
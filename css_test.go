@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCSSURLs(t *testing.T) {
+	css := `
+		@import url("theme.css");
+		body { background: URL( 'img/bg.png' ) no-repeat; }
+		@font-face { src: url(/fonts/a.woff2) format("woff2"), url(data:font/woff;base64,AAAA); }
+		/* .old { background: url(old.png); } */
+		.clip { clip-path: url(#clip); mask: url(""); }
+		.icon { background-image: url(icons/a\ b.svg ); }
+	`
+	want := []string{"theme.css", "img/bg.png", "/fonts/a.woff2", `icons/a\ b.svg`}
+	if got := cssURLs(css); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestStartScraper_CheckCSSAssets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/css/site.css"></head><body>Home</body></html>`)
+		case "/css/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `body { background: url("../img/missing.png"); } h1 { background: url(/img/ok.png); }`)
+		case "/img/ok.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	if deadLinks, err := StartScraperWithConfig(ts.URL, cfg); err != nil || len(deadLinks) != 0 {
+		t.Fatalf("Expected stylesheets to be ignored by default, got: %v, %v", deadLinks, err)
+	}
+
+	cfg.CheckCSSAssets = true
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 1 {
+		t.Fatalf("Expected 1 dead link, got: %+v", deadLinks)
+	}
+	deadLink := findDeadLink(deadLinks, ts.URL+"/img/missing.png")
+	if deadLink == nil {
+		t.Fatalf("Expected the missing background image to be reported, got: %+v", deadLinks)
+	}
+	if deadLink.Referrer != ts.URL+"/css/site.css" || deadLink.Rel != "css" {
+		t.Errorf("Expected the stylesheet as referrer and rel \"css\", got: %+v", deadLink)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// DegradedPage is a live page many of whose assets are dead.
+type DegradedPage struct {
+	URL string `json:"url"`
+	// Assets counts the distinct assets of the page, and DeadAssets those
+	// that are dead.
+	Assets     int `json:"assets"`
+	DeadAssets int `json:"dead_assets"`
+}
+
+// assets returns the linkKey of the distinct assets among links.
+func (data *WorkerData) assets(links []link) []string {
+	var assets []string
+	for _, l := range links {
+		if isAsset(l.rel) {
+			assets = append(assets, data.linkKey(l.url))
+		}
+	}
+	slices.Sort(assets)
+	return slices.Compact(assets)
+}
+
+// degradedPages returns the pages with at least threshold of their assets
+// among the dead URLs, sorted by URL. Pages without assets are never
+// degraded. Assets and dead URLs are keyed by linkKey.
+func degradedPages(assets map[string][]string, dead map[string]struct{}, threshold float64, logger *slog.Logger) []DegradedPage {
+	var degraded []DegradedPage
+	for page, pageAssets := range assets {
+		if len(pageAssets) == 0 {
+			continue
+		}
+		deadAssets := 0
+		for _, asset := range pageAssets {
+			if _, ok := dead[asset]; ok {
+				deadAssets++
+			}
+		}
+		if float64(deadAssets)/float64(len(pageAssets)) < threshold {
+			continue
+		}
+		logger.Info(fmt.Sprintf("Found degraded page: %s, %d of %d assets dead", page, deadAssets, len(pageAssets)))
+		degraded = append(degraded, DegradedPage{URL: page, Assets: len(pageAssets), DeadAssets: deadAssets})
+	}
+	slices.SortFunc(degraded, func(a, b DegradedPage) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+	return degraded
+}
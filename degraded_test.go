@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestStartScraper_DegradedPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/missing.css"></head><body>
+				<img srcset="/missing-1x.png 1x, /missing-2x.png 2x">
+				<img srcset="/logo.png">
+				<a href="/fine">Fine</a>
+			</body></html>`)
+		case "/fine":
+			fmt.Fprint(w, `<html><body><img srcset="/logo.png"><img srcset="/missing-1x.png"><a href="/">Home</a></body></html>`)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.CheckCSSAssets = true
+	cfg.DegradedThreshold = 0.6
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []DegradedPage{{URL: ts.URL + "/", Assets: 4, DeadAssets: 3}}
+	if !slices.Equal(result.DegradedPages, want) {
+		t.Errorf("Expected degraded pages %+v, got %+v", want, result.DegradedPages)
+	}
+}
+
+func TestStartScraper_DegradedPagesNormalizeTrailingSlash(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><img srcset="/missing-1x 1x, /missing-2x 2x"><img srcset="/logo.png"></body></html>`)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.DegradedThreshold = 0.6
+	cfg.NormalizeTrailingSlash = TrailingSlashAdd
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []DegradedPage{{URL: ts.URL + "/", Assets: 3, DeadAssets: 2}}
+	if !slices.Equal(result.DegradedPages, want) {
+		t.Errorf("Expected degraded pages %+v, got %+v", want, result.DegradedPages)
+	}
+}
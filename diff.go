@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// DiffResults compares the dead links of two crawls. newlyDead lists the
+// links of new that were not dead in old, and fixed the links of old that are
+// no longer dead in new. Links are matched by normalized URL, so a link that
+// stays dead with a different status is in neither list.
+func DiffResults(old, new Result) (newlyDead, fixed []DeadLink) {
+	oldKeys := deadLinkKeys(old)
+	newKeys := deadLinkKeys(new)
+	for _, deadLink := range new.DeadLinks {
+		if _, ok := oldKeys[normalizeURL(deadLink.URL)]; !ok {
+			newlyDead = append(newlyDead, deadLink)
+		}
+	}
+	for _, deadLink := range old.DeadLinks {
+		if _, ok := newKeys[normalizeURL(deadLink.URL)]; !ok {
+			fixed = append(fixed, deadLink)
+		}
+	}
+	return newlyDead, fixed
+}
+
+func deadLinkKeys(result Result) map[string]struct{} {
+	keys := make(map[string]struct{}, len(result.DeadLinks))
+	for _, deadLink := range result.DeadLinks {
+		keys[normalizeURL(deadLink.URL)] = struct{}{}
+	}
+	return keys
+}
+
+// normalizeURL returns u the way the crawler would have visited it: without
+// query or fragment and with a lowercase host. Unparsable URLs are returned
+// as is.
+func normalizeURL(u string) string {
+	clean, err := cleanURL(u, nil)
+	if err != nil {
+		return u
+	}
+	clean.Host = strings.ToLower(clean.Host)
+	if clean.Path == "" {
+		clean.Path = "/"
+	}
+	return clean.String()
+}
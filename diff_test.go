@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffResults(t *testing.T) {
+	old := Result{DeadLinks: []DeadLink{
+		{URL: "https://example.com/fixed", StatusCode: 404},
+		{URL: "https://example.com/still-dead", StatusCode: 404},
+		{URL: "https://example.com/status-changed", StatusCode: 404},
+	}}
+	new := Result{DeadLinks: []DeadLink{
+		{URL: "https://EXAMPLE.com/still-dead#top", StatusCode: 404},
+		{URL: "https://example.com/status-changed", StatusCode: 503},
+		{URL: "https://example.com/broken", StatusCode: 500},
+	}}
+
+	newlyDead, fixed := DiffResults(old, new)
+	urls := func(deadLinks []DeadLink) []string {
+		out := make([]string, 0, len(deadLinks))
+		for _, deadLink := range deadLinks {
+			out = append(out, deadLink.URL)
+		}
+		return out
+	}
+	if want := []string{"https://example.com/broken"}; !slices.Equal(urls(newlyDead), want) {
+		t.Errorf("Expected newly dead %v, got %v", want, urls(newlyDead))
+	}
+	if want := []string{"https://example.com/fixed"}; !slices.Equal(urls(fixed), want) {
+		t.Errorf("Expected fixed %v, got %v", want, urls(fixed))
+	}
+
+	newlyDead, fixed = DiffResults(Result{}, new)
+	if len(newlyDead) != len(new.DeadLinks) || len(fixed) != 0 {
+		t.Errorf("Expected every link to be newly dead against an empty crawl, got %v and %v", newlyDead, fixed)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "errors"
+
+// Errors returned by Scraper.Run. They wrap their underlying cause, so both
+// can be matched with errors.Is.
+var (
+	// ErrInvalidSeed means the seed URL could not be parsed or is not an
+	// http(s) URL.
+	ErrInvalidSeed = errors.New("invalid seed URL")
+	// ErrSeedUnreachable means the seed URL could not be fetched, or
+	// returned a dead status.
+	ErrSeedUnreachable = errors.New("seed URL unreachable")
+	// ErrBudgetExceeded means the crawl stopped early because it reached
+	// Config.MaxPages. The links found so far are still returned.
+	ErrBudgetExceeded = errors.New("crawl budget exceeded")
+	// ErrCancelled means the crawl's context was cancelled. The links found
+	// so far are still returned.
+	ErrCancelled = errors.New("crawl cancelled")
+	// ErrIdleTimeout means the crawl was aborted because no URL was checked
+	// for Config.MaxIdleTime. The links found so far are still returned.
+	ErrIdleTimeout = errors.New("crawl stalled")
+	// ErrTooManyDeadLinks means the crawl was aborted because more than
+	// Config.MaxDeadLinks dead links were found. The first ones are still
+	// returned.
+	ErrTooManyDeadLinks = errors.New("too many dead links")
+)
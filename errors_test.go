@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRun_InvalidSeed(t *testing.T) {
+	for _, seed := range []string{"invalid-url", "ftp://example.com", "http://[::1"} {
+		_, err := NewScraper(DefaultConfig()).Run(context.Background(), seed)
+		if !errors.Is(err, ErrInvalidSeed) {
+			t.Errorf("Expected ErrInvalidSeed for %q, got: %v", seed, err)
+		}
+	}
+}
+
+func TestRun_SeedUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	_, err := NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if !errors.Is(err, ErrSeedUnreachable) {
+		t.Errorf("Expected ErrSeedUnreachable, got: %v", err)
+	}
+
+	// A seed that cannot be connected to wraps the network error.
+	ts.Close()
+	_, err = NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if !errors.Is(err, ErrSeedUnreachable) {
+		t.Errorf("Expected ErrSeedUnreachable, got: %v", err)
+	}
+}
+
+func TestRun_BudgetExceeded(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a></body></html>`)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxPages = 2
+	_, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got: %v", err)
+	}
+
+	// A budget that is large enough is not an error.
+	cfg.MaxPages = 4
+	if _, err = NewScraper(cfg).Run(context.Background(), ts.URL); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>No links</body></html>`)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewScraper(DefaultConfig()).Run(ctx, ts.URL)
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("Expected ErrCancelled, got: %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context error to be wrapped, got: %v", err)
+	}
+}
+
+func TestRun_IdleTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a><a href="/hang">Hang</a></body></html>`)
+		case "/hang":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Timeout = time.Minute
+	cfg.MaxIdleTime = 200 * time.Millisecond
+	start := time.Now()
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("Expected ErrIdleTimeout, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the watchdog to stop the crawl early, took %s", elapsed)
+	}
+	if findDeadLink(result.DeadLinks, ts.URL+"/dead") == nil {
+		t.Errorf("Expected partial results, got: %v", result.DeadLinks)
+	}
+}
+
+func TestRun_TooManyDeadLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><body>")
+		for i := range 5 {
+			fmt.Fprintf(w, `<a href="/dead%d">Dead</a>`, i)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxDeadLinks = 2
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if !errors.Is(err, ErrTooManyDeadLinks) {
+		t.Errorf("Expected ErrTooManyDeadLinks, got: %v", err)
+	}
+	if len(result.DeadLinks) != 2 || !result.DeadLinksTruncated {
+		t.Errorf("Expected the dead links to be truncated at 2, got %d (truncated: %t)", len(result.DeadLinks), result.DeadLinksTruncated)
+	}
+
+	// Reaching the cap is not an error.
+	cfg.MaxDeadLinks = 5
+	result, err = NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if len(result.DeadLinks) != 5 || result.DeadLinksTruncated {
+		t.Errorf("Expected all 5 dead links, got %d (truncated: %t)", len(result.DeadLinks), result.DeadLinksTruncated)
+	}
+}
+
+func TestRun_OnComplete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a><a href="/cancel">Cancel</a></body></html>`)
+		case "/cancel":
+			cancel()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	var calls []Result
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	cfg.OnComplete = func(result Result) {
+		calls = append(calls, result)
+	}
+	result, err := NewScraper(cfg).Run(ctx, ts.URL)
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("Expected ErrCancelled, got: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("Expected OnComplete to be called once, got %d calls", len(calls))
+	}
+	if !slices.EqualFunc(calls[0].DeadLinks, result.DeadLinks, func(a, b DeadLink) bool { return a.URL == b.URL }) {
+		t.Errorf("Expected OnComplete to get the result, got %v instead of %v", calls[0].DeadLinks, result.DeadLinks)
+	}
+	if findDeadLink(calls[0].DeadLinks, ts.URL+"/dead") == nil {
+		t.Errorf("Expected the partial result, got: %v", calls[0].DeadLinks)
+	}
+}
+
+func TestRun_OnCompleteAfterWorkersExit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>No links</body></html>`)
+	}))
+	defer ts.Close()
+
+	// The staggered workers are still waiting to start when the crawl is
+	// over.
+	cfg := DefaultConfig()
+	cfg.Workers = 3
+	cfg.WorkerStartStagger = time.Hour
+	var s *Scraper
+	var stats Stats
+	cfg.OnComplete = func(Result) { stats = s.Stats() }
+	s = NewScraper(cfg)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Run(context.Background(), ts.URL)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Crawl did not finish while workers were waiting to start")
+	}
+	if stats.Requests != 1 || stats.Workers != 0 {
+		t.Errorf("Expected 1 request and no workers left running, got: %+v", stats)
+	}
+}
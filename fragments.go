@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// BrokenFragment is a link to an anchor that its page does not have.
+type BrokenFragment struct {
+	// URL is the linked page, without the fragment.
+	URL      string `json:"url"`
+	Fragment string `json:"fragment"`
+	// Referrer is the page the link was found on.
+	Referrer string         `json:"referrer"`
+	Reason   FragmentReason `json:"reason"`
+}
+
+// FragmentReason tells why a fragment link is broken.
+type FragmentReason string
+
+const (
+	// FragmentAnchorMissing means the page has no anchor by that name.
+	FragmentAnchorMissing FragmentReason = "anchor_missing"
+	// FragmentTargetMissing means the page itself is a dead link.
+	FragmentTargetMissing FragmentReason = "target_missing"
+)
+
+// fragmentLink is a link to an anchor, checked once the crawl is done.
+type fragmentLink struct {
+	target string
+	// key is the linkKey of target, under which its anchors are recorded.
+	key      string
+	fragment string
+	referrer string
+}
+
+// fragment returns the decoded fragment of href, or "" if it has none.
+func fragment(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return u.Fragment
+}
+
+// brokenFragments returns the links whose fragment names no anchor of their
+// target, given the anchors of each crawled page, and those whose target is
+// one of the dead URLs. Links to other pages that were not crawled cannot be
+// verified, and are left out. Anchors and dead URLs are keyed by linkKey.
+func brokenFragments(anchors map[string][]string, links []fragmentLink, dead map[string]struct{}, logger *slog.Logger) []BrokenFragment {
+	var broken []BrokenFragment
+	for _, l := range links {
+		if _, ok := dead[l.key]; ok {
+			broken = append(broken, BrokenFragment{URL: l.target, Fragment: l.fragment, Referrer: l.referrer, Reason: FragmentTargetMissing})
+			continue
+		}
+		ids, crawled := anchors[l.key]
+		// An empty fragment or #top scroll to the top of any page.
+		if !crawled || l.fragment == "" || strings.EqualFold(l.fragment, "top") || slices.Contains(ids, l.fragment) {
+			continue
+		}
+		logger.Info(fmt.Sprintf("Found broken fragment: %s#%s, on %s", l.target, l.fragment, l.referrer))
+		broken = append(broken, BrokenFragment{URL: l.target, Fragment: l.fragment, Referrer: l.referrer, Reason: FragmentAnchorMissing})
+	}
+	slices.SortFunc(broken, func(a, b BrokenFragment) int {
+		return cmp.Or(cmp.Compare(a.URL, b.URL), cmp.Compare(a.Fragment, b.Fragment), cmp.Compare(a.Referrer, b.Referrer))
+	})
+	return slices.Compact(broken)
+}
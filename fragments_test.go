@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestStartScraper_CheckFragments(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body>
+				<a href="/b#sec">Missing section</a>
+				<a href="/b#intro">Intro</a>
+				<a href="/b#legacy">Legacy anchor</a>
+				<a href="#top">Top</a>
+				<a href="#local">Missing local</a>
+				<a href="/text#anything">Not HTML</a>
+				<a href="/gone#anything">Dead</a>
+			</body></html>`)
+		case "/b":
+			fmt.Fprint(w, `<html><body><h2 id="intro">Intro</h2><a name="legacy"></a><a href="/#sec">Back</a></body></html>`)
+		case "/gone":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.CheckFragments = true
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []BrokenFragment{
+		{URL: ts.URL + "/", Fragment: "local", Referrer: ts.URL + "/", Reason: FragmentAnchorMissing},
+		{URL: ts.URL + "/", Fragment: "sec", Referrer: ts.URL + "/b", Reason: FragmentAnchorMissing},
+		{URL: ts.URL + "/b", Fragment: "sec", Referrer: ts.URL + "/", Reason: FragmentAnchorMissing},
+		{URL: ts.URL + "/gone", Fragment: "anything", Referrer: ts.URL + "/", Reason: FragmentTargetMissing},
+	}
+	if !slices.Equal(result.BrokenFragments, want) {
+		t.Errorf("Expected broken fragments %+v, got %+v", want, result.BrokenFragments)
+	}
+}
+
+func TestStartScraper_CheckFragmentsNormalizeTrailingSlash(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body>
+				<a href="/docs#intro">Intro</a>
+				<a href="/docs#missing">Missing section</a>
+				<a href="/gone#anything">Dead</a>
+			</body></html>`)
+		case "/docs/":
+			fmt.Fprint(w, `<html><body><h2 id="intro">Intro</h2></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.CheckFragments = true
+	cfg.NormalizeTrailingSlash = TrailingSlashAdd
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []BrokenFragment{
+		{URL: ts.URL + "/docs/", Fragment: "missing", Referrer: ts.URL + "/", Reason: FragmentAnchorMissing},
+		{URL: ts.URL + "/gone/", Fragment: "anything", Referrer: ts.URL + "/", Reason: FragmentTargetMissing},
+	}
+	if !slices.Equal(result.BrokenFragments, want) {
+		t.Errorf("Expected broken fragments %+v, got %+v", want, result.BrokenFragments)
+	}
+}
+
+func TestScraper_ReportDuplicateIDs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><h2 id="intro">Intro</h2><p id="intro">Again</p><div id="x"></div><div id="intro"></div><a href="/ok">OK</a></body></html>`)
+		case "/ok":
+			fmt.Fprint(w, `<html><body><h2 id="a">A</h2><h2 id="b">B</h2></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.DuplicateIDPages != nil {
+		t.Errorf("Expected no duplicate ids by default, got: %v", result.DuplicateIDPages)
+	}
+
+	cfg.ReportDuplicateIDs = true
+	result, err = NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.DuplicateIDPages) != 1 || !slices.Equal(result.DuplicateIDPages[ts.URL], []string{"intro"}) {
+		t.Errorf("Expected the home page to repeat the intro id, got: %v", result.DuplicateIDPages)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/url"
+	"time"
+)
+
+// Frontier holds the jobs waiting to be dispatched to workers. A crawl only
+// uses it from one goroutine, so it needs no locking.
+type Frontier interface {
+	// Push adds a job. The jobs found on a page are pushed in document
+	// order. A job returned by Pop may be pushed back when new jobs arrive
+	// before a worker takes it, so that it competes with them.
+	Push(j *Job)
+	// Pop removes and returns the next job to crawl. It reports false if
+	// the frontier is empty.
+	Pop() (*Job, bool)
+	// Len returns the number of jobs waiting.
+	Len() int
+}
+
+// Job is a URL waiting in a Frontier. Frontiers must only return the jobs
+// pushed to them.
+type Job struct {
+	URL *url.URL
+	// Referrer is the page URL was found on. It is nil for the seed and for
+	// sitemap entries.
+	Referrer *url.URL
+	// Depth is the number of links followed from the seed to URL.
+	Depth int
+
+	job *job
+	// seq orders the jobs of a priorityFrontier that have the same
+	// priority.
+	seq uint64
+}
+
+// frontier is the default Frontier, a queue or a stack depending on the
+// Strategy.
+type frontier struct {
+	jobs []*Job
+	// lifo makes the frontier a stack, for depth-first crawling.
+	lifo bool
+}
+
+func newFrontier(strategy Strategy) *frontier {
+	return &frontier{lifo: strategy == StrategyDFS}
+}
+
+func (f *frontier) Push(j *Job) {
+	f.jobs = append(f.jobs, j)
+}
+
+func (f *frontier) Pop() (*Job, bool) {
+	if len(f.jobs) == 0 {
+		return nil, false
+	}
+	next := f.peek()
+	if f.lifo {
+		f.jobs[len(f.jobs)-1] = nil
+		f.jobs = f.jobs[:len(f.jobs)-1]
+	} else {
+		f.jobs[0] = nil
+		f.jobs = f.jobs[1:]
+	}
+	return next, true
+}
+
+// peek returns the job that Pop would remove. The frontier must not be
+// empty.
+func (f *frontier) peek() *Job {
+	if f.lifo {
+		return f.jobs[len(f.jobs)-1]
+	}
+	return f.jobs[0]
+}
+
+func (f *frontier) Len() int {
+	return len(f.jobs)
+}
+
+// dispatchQueue adapts a Frontier to the link handler, which needs to look
+// at the next job before a worker is ready to take it.
+type dispatchQueue struct {
+	frontier Frontier
+	// builtin is frontier if it is the default one, which can be peeked at
+	// without popping.
+	builtin *frontier
+	// reverse pushes the links of a page in reverse, so that a stack still
+	// pops them in document order.
+	reverse bool
+	// next is the job popped from the frontier for the next dispatch.
+	next *Job
+}
+
+func newDispatchQueue(cfg *Config) *dispatchQueue {
+	if cfg.NewFrontier != nil {
+		return &dispatchQueue{frontier: cfg.NewFrontier()}
+	}
+	if cfg.Priority != nil {
+		return &dispatchQueue{frontier: newPriorityFrontier(cfg.Priority)}
+	}
+	f := newFrontier(cfg.Strategy)
+	return &dispatchQueue{frontier: f, builtin: f, reverse: f.lifo}
+}
+
+// push adds the links found on a page.
+func (q *dispatchQueue) push(jobs ...*job) {
+	now := time.Now()
+	for _, j := range jobs {
+		j.queued = now
+	}
+	if q.next != nil {
+		q.frontier.Push(q.next)
+		q.next = nil
+	}
+	for i := range jobs {
+		if q.reverse {
+			i = len(jobs) - 1 - i
+		}
+		q.frontier.Push(q.wrap(jobs[i]))
+	}
+}
+
+func (q *dispatchQueue) wrap(j *job) *Job {
+	return &Job{URL: j.url, Referrer: j.referrer, Depth: j.depth, job: j}
+}
+
+// peek returns the job that pop would remove. The queue must not be empty.
+func (q *dispatchQueue) peek() *job {
+	if q.builtin != nil {
+		return q.builtin.peek().job
+	}
+	if q.next == nil {
+		q.next, _ = q.frontier.Pop()
+	}
+	return q.next.job
+}
+
+// pop removes and returns the next job. The queue must not be empty.
+func (q *dispatchQueue) pop() *job {
+	next := q.peek()
+	if q.builtin != nil {
+		q.builtin.Pop()
+	}
+	q.next = nil
+	return next
+}
+
+func (q *dispatchQueue) len() int {
+	if q.next != nil {
+		return q.frontier.Len() + 1
+	}
+	return q.frontier.Len()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// greatestFirst is a Frontier that pops the lexically greatest URL first.
+type greatestFirst struct {
+	jobs   []*Job
+	depths map[string]int
+}
+
+func (f *greatestFirst) Push(j *Job) {
+	f.jobs = append(f.jobs, j)
+	f.depths[j.URL.Path] = j.Depth
+}
+
+func (f *greatestFirst) Pop() (*Job, bool) {
+	if len(f.jobs) == 0 {
+		return nil, false
+	}
+	i := 0
+	for k, j := range f.jobs {
+		if j.URL.String() > f.jobs[i].URL.String() {
+			i = k
+		}
+	}
+	next := f.jobs[i]
+	f.jobs = slices.Delete(f.jobs, i, i+1)
+	return next, true
+}
+
+func (f *greatestFirst) Len() int {
+	return len(f.jobs)
+}
+
+func TestStartScraper_NewFrontier(t *testing.T) {
+	site := map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/a1"},
+		"/b": {"/b1"},
+	}
+	var mu sync.Mutex
+	visits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visits = append(visits, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, "<html><body>")
+		for _, href := range site[r.URL.Path] {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, href)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer ts.Close()
+
+	frontier := &greatestFirst{depths: make(map[string]int)}
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	cfg.Strategy = StrategyDFS
+	cfg.NewFrontier = func() Frontier { return frontier }
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// /b1 is found while /a waits, and still goes first.
+	want := []string{"/", "/b", "/b1", "/a", "/a1"}
+	if !slices.Equal(visits, want) {
+		t.Errorf("Expected visit order %v, got %v", want, visits)
+	}
+	if frontier.depths["/b"] != 1 || frontier.depths["/b1"] != 2 {
+		t.Errorf("Expected depths to count links from the seed, got: %v", frontier.depths)
+	}
+}
+
+func TestStartScraper_Priority(t *testing.T) {
+	site := map[string][]string{
+		"/":       {"/a", "/docs", "/b"},
+		"/a":      {"/a1"},
+		"/docs":   {"/docs/1"},
+		"/b":      {},
+		"/docs/1": {},
+	}
+	var mu sync.Mutex
+	visits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visits = append(visits, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, "<html><body>")
+		for _, href := range site[r.URL.Path] {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, href)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	// Docs first, then shallow pages first.
+	cfg.Priority = func(u *url.URL, depth int) int {
+		if strings.HasPrefix(u.Path, "/docs") {
+			return 100
+		}
+		return -depth
+	}
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	want := []string{"/", "/docs", "/docs/1", "/a", "/b", "/a1"}
+	if !slices.Equal(visits, want) {
+		t.Errorf("Expected visit order %v, got %v", want, visits)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// selfLinks returns the pages that link to themselves.
+func selfLinks(pages []Page) []string {
+	var self []string
+	for _, page := range pages {
+		if slices.Contains(page.Links, page.URL) {
+			self = append(self, page.URL)
+		}
+	}
+	slices.Sort(self)
+	return self
+}
+
+// linkCycles returns the groups of at least minSize pages that can all be
+// reached from one another by following links, the strongly connected
+// components of the link graph. Pages and groups are sorted.
+func linkCycles(pages []Page, minSize int) [][]string {
+	graph := make(map[string][]string, len(pages))
+	for _, page := range pages {
+		graph[page.URL] = page.Links
+	}
+
+	// Tarjan's algorithm.
+	index := make(map[string]int, len(pages))
+	lowlink := make(map[string]int, len(pages))
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	var visit func(u string)
+	visit = func(u string) {
+		index[u] = len(index)
+		lowlink[u] = index[u]
+		stack = append(stack, u)
+		onStack[u] = true
+		for _, v := range graph[u] {
+			if _, crawled := graph[v]; !crawled {
+				continue
+			}
+			if _, visited := index[v]; !visited {
+				visit(v)
+				lowlink[u] = min(lowlink[u], lowlink[v])
+			} else if onStack[v] {
+				lowlink[u] = min(lowlink[u], index[v])
+			}
+		}
+		if lowlink[u] != index[u] {
+			return
+		}
+		var component []string
+		for {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[v] = false
+			component = append(component, v)
+			if v == u {
+				break
+			}
+		}
+		if len(component) >= minSize {
+			slices.Sort(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, page := range pages {
+		if _, visited := index[page.URL]; !visited {
+			visit(page.URL)
+		}
+	}
+	slices.SortFunc(cycles, func(a, b []string) int {
+		return slices.Compare(a, b)
+	})
+	return cycles
+}
+
+// reachabilityBySeed maps the pages that can be reached from seeds by
+// following links to the seeds that reach them, in the order of seeds.
+func reachabilityBySeed(pages []Page, seeds []string) map[string][]string {
+	graph := make(map[string][]string, len(pages))
+	for _, page := range pages {
+		graph[page.URL] = page.Links
+	}
+
+	reachability := make(map[string][]string)
+	for _, seed := range seeds {
+		if _, crawled := graph[seed]; !crawled {
+			continue
+		}
+		visited := map[string]bool{seed: true}
+		queue := []string{seed}
+		for len(queue) > 0 {
+			u := queue[0]
+			queue = queue[1:]
+			if !slices.Contains(reachability[u], seed) {
+				reachability[u] = append(reachability[u], seed)
+			}
+			for _, v := range graph[u] {
+				if _, crawled := graph[v]; crawled && !visited[v] {
+					visited[v] = true
+					queue = append(queue, v)
+				}
+			}
+		}
+	}
+	return reachability
+}
+
+// PrintTree writes r.DiscoveryTree to w, one URL per line, indented under
+// the page it was first found on. Roots, such as the seed, come first, and
+// siblings are sorted.
+func (r Result) PrintTree(w io.Writer) error {
+	children := make(map[string][]string)
+	var roots []string
+	for child, parent := range r.DiscoveryTree {
+		if _, known := r.DiscoveryTree[parent]; parent == "" || !known {
+			roots = append(roots, child)
+		} else {
+			children[parent] = append(children[parent], child)
+		}
+	}
+	slices.Sort(roots)
+
+	var print func(u string, depth int) error
+	print = func(u string, depth int) error {
+		if _, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), u); err != nil {
+			return err
+		}
+		kids := children[u]
+		slices.Sort(kids)
+		for _, kid := range kids {
+			if err := print(kid, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := print(root, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
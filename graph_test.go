@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLinkCycles(t *testing.T) {
+	pages := []Page{
+		{URL: "a", Links: []string{"b"}},
+		{URL: "b", Links: []string{"c", "external"}},
+		{URL: "c", Links: []string{"a", "d"}},
+		{URL: "d", Links: []string{"e"}},
+		{URL: "e", Links: []string{"d"}},
+		{URL: "f", Links: []string{"f"}},
+	}
+	tests := []struct {
+		minSize int
+		want    [][]string
+	}{
+		{1, [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}}},
+		{2, [][]string{{"a", "b", "c"}, {"d", "e"}}},
+		{3, [][]string{{"a", "b", "c"}}},
+		{4, nil},
+	}
+	for _, tt := range tests {
+		if got := linkCycles(pages, tt.minSize); !slices.EqualFunc(got, tt.want, slices.Equal[[]string]) {
+			t.Errorf("linkCycles(%d) = %v, want %v", tt.minSize, got, tt.want)
+		}
+	}
+}
+
+func TestStartScraper_SelfLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/a">A</a><a href="/b">B</a></body></html>`)
+		case "/a":
+			fmt.Fprint(w, `<html><body><a href="/a">Here</a><a href="/b">B</a></body></html>`)
+		case "/b":
+			fmt.Fprint(w, `<html><body><a href="/c">C</a></body></html>`)
+		case "/c":
+			fmt.Fprint(w, `<html><body><a href="/b">B</a></body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MinCycleSize = 2
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if want := []string{ts.URL + "/a"}; !slices.Equal(result.SelfLinks, want) {
+		t.Errorf("Expected self-links %v, got %v", want, result.SelfLinks)
+	}
+	if want := [][]string{{ts.URL + "/b", ts.URL + "/c"}}; !slices.EqualFunc(result.LinkCycles, want, slices.Equal[[]string]) {
+		t.Errorf("Expected link cycles %v, got %v", want, result.LinkCycles)
+	}
+}
+
+func TestStartScraper_ReachabilityBySeed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs":
+			fmt.Fprint(w, `<html><body><a href="/guide">Guide</a><a href="/shared">Shared</a></body></html>`)
+		case "/shop":
+			fmt.Fprint(w, `<html><body><a href="/cart">Cart</a><a href="/shared">Shared</a></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body>No links</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Seeds = []string{ts.URL + "/shop"}
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/docs")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	docs, shop := ts.URL+"/docs", ts.URL+"/shop"
+	want := map[string][]string{
+		docs:               {docs},
+		ts.URL + "/guide":  {docs},
+		ts.URL + "/shared": {docs, shop},
+		shop:               {shop},
+		ts.URL + "/cart":   {shop},
+	}
+	if !maps.EqualFunc(result.ReachabilityBySeed, want, slices.Equal[[]string]) {
+		t.Errorf("Expected reachability %v, got %v", want, result.ReachabilityBySeed)
+	}
+}
+
+func TestScraper_DiscoveryTree(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/a">A</a><a href="/b">B</a></body></html>`)
+		case "/a":
+			fmt.Fprint(w, `<html><body><a href="/b">B</a><a href="/c">C</a></body></html>`)
+		case "/b":
+			fmt.Fprint(w, `<html><body><a href="/c">C</a><a href="/a">A</a></body></html>`)
+		case "/c":
+			fmt.Fprint(w, `<html><body><a href="/gone">Gone</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// A single worker crawls breadth-first, so /c is first found on /a.
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := map[string]string{
+		ts.URL:           "",
+		ts.URL + "/a":    ts.URL,
+		ts.URL + "/b":    ts.URL,
+		ts.URL + "/c":    ts.URL + "/a",
+		ts.URL + "/gone": ts.URL + "/c",
+	}
+	if !maps.Equal(result.DiscoveryTree, want) {
+		t.Errorf("Expected discovery tree %v, got: %v", want, result.DiscoveryTree)
+	}
+
+	var sb strings.Builder
+	if err := result.PrintTree(&sb); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	wantTree := ts.URL + "\n" +
+		"  " + ts.URL + "/a\n" +
+		"    " + ts.URL + "/c\n" +
+		"      " + ts.URL + "/gone\n" +
+		"  " + ts.URL + "/b\n"
+	if got := sb.String(); got != wantTree {
+		t.Errorf("Expected tree:\n%s\ngot:\n%s", wantTree, got)
+	}
+}
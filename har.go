@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// harLog is the subset of the HAR 1.2 format that a crawl records and
+// replays.
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	} `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	Cookies     []harHeader `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []harHeader `json:"cookies"`
+	Content     struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		// Encoding is "base64" if Text is encoded so, which is how bodies
+		// are recorded.
+		Encoding string `json:"encoding,omitempty"`
+	} `json:"content"`
+	RedirectURL string `json:"redirectURL"`
+	HeadersSize int    `json:"headersSize"`
+	BodySize    int    `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func harHeaders(header http.Header) []harHeader {
+	headers := make([]harHeader, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// harRedacted are the request headers left out of a recording, since they
+// carry the credentials of the crawl.
+var harRedacted = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func harRequestHeaders(header http.Header) []harHeader {
+	header = header.Clone()
+	for _, name := range harRedacted {
+		header.Del(name)
+	}
+	return harHeaders(header)
+}
+
+// harRecorder is a transport recording the responses it receives, for
+// Config.RecordHAR. A response is recorded when its body is closed, with the
+// bytes the crawler read from it, up to limit.
+type harRecorder struct {
+	next  http.RoundTripper
+	limit int64
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+func (r *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := harEntry{StartedDateTime: start}
+	entry.Timings.Wait = float64(time.Since(start)) / float64(time.Millisecond)
+	entry.Request = harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Headers:     harRequestHeaders(req.Header),
+		QueryString: []harHeader{},
+		Cookies:     []harHeader{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harHeader{},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+	resp.Body = &harBody{ReadCloser: resp.Body, recorder: r, entry: entry}
+	return resp, nil
+}
+
+// harBody keeps what is read from a response body, and records the response
+// once the body is closed.
+type harBody struct {
+	io.ReadCloser
+	recorder *harRecorder
+	entry    harEntry
+	body     bytes.Buffer
+	once     sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.recorder.limit - int64(b.body.Len()); room > 0 {
+		b.body.Write(p[:min(int64(n), room)])
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		entry := b.entry
+		body := b.body.Bytes()
+		entry.Time = float64(time.Since(entry.StartedDateTime)) / float64(time.Millisecond)
+		entry.Timings.Receive = entry.Time - entry.Timings.Wait
+		entry.Response.BodySize = len(body)
+		entry.Response.Content.Size = len(body)
+		entry.Response.Content.Text = base64.StdEncoding.EncodeToString(body)
+		entry.Response.Content.Encoding = "base64"
+
+		b.recorder.mu.Lock()
+		b.recorder.entries = append(b.recorder.entries, entry)
+		b.recorder.mu.Unlock()
+	})
+	return err
+}
+
+// save writes the recorded responses to path as a HAR file.
+func (r *harRecorder) save(path string) error {
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "scraper"
+	har.Log.Creator.Version = "1.0"
+	r.mu.Lock()
+	har.Log.Entries = r.entries
+	r.mu.Unlock()
+	if har.Log.Entries == nil {
+		har.Log.Entries = []harEntry{}
+	}
+
+	content, err := json.Marshal(har)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// harReplay is a transport answering requests with the responses of a HAR
+// file, keyed by method and URL. A request made several times, such as a
+// retried one, gets the recorded responses in order, then the last one
+// again.
+type harReplay struct {
+	mu        sync.Mutex
+	responses map[string][]harResponse
+}
+
+func newHARReplay(path string) (*harReplay, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harLog
+	if err := json.Unmarshal(content, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+	replay := &harReplay{responses: make(map[string][]harResponse)}
+	for _, entry := range har.Log.Entries {
+		key := entry.Request.Method + " " + entry.Request.URL
+		replay.responses[key] = append(replay.responses[key], entry.Response)
+	}
+	return replay, nil
+}
+
+func (r *harReplay) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+	r.mu.Lock()
+	responses := r.responses[key]
+	if len(responses) > 1 {
+		r.responses[key] = responses[1:]
+	}
+	r.mu.Unlock()
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no recorded response for %s", key)
+	}
+
+	recorded := responses[0]
+	body := []byte(recorded.Content.Text)
+	if recorded.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(recorded.Content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded body for %s: %w", key, err)
+		}
+		body = decoded
+	}
+	header := make(http.Header)
+	for _, h := range recorded.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, recorded.StatusText),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// ReplayScraper returns a scraper that crawls from the responses recorded
+// in the HAR file at harPath, such as one written with Config.RecordHAR,
+// instead of the network. Requests that were not recorded fail.
+func ReplayScraper(harPath string, cfg Config) (*Scraper, error) {
+	replay, err := newHARReplay(harPath)
+	if err != nil {
+		return nil, err
+	}
+	s := NewScraper(cfg)
+	s.transport = replay
+	return s, nil
+}
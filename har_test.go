@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayScraper(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/a">A</a><a href="/old">Old</a><a href="/missing">Missing</a><img src="/logo.png"></body></html>`)
+		case "/a":
+			fmt.Fprint(w, `<html><body><a href="/">Home</a><a href="/gone">Gone</a></body></html>`)
+		case "/old":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0, 0xff})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	// A single worker keeps the crawl order, and so the referrers, stable.
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	cfg.SortResults = SortByURL
+	cfg.RecordHAR = filepath.Join(t.TempDir(), "crawl.har")
+	recorded, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(recorded.DeadLinks) != 2 {
+		t.Fatalf("Expected 2 dead links, got: %+v", recorded.DeadLinks)
+	}
+	// The replay must not need the server.
+	ts.Close()
+
+	harPath := cfg.RecordHAR
+	cfg.RecordHAR = ""
+	s, err := ReplayScraper(harPath, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	replayed, err := s.Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// Only when the links were found differs.
+	for i := range recorded.DeadLinks {
+		recorded.DeadLinks[i].FoundAt = time.Time{}
+	}
+	for i := range replayed.DeadLinks {
+		replayed.DeadLinks[i].FoundAt = time.Time{}
+	}
+	if !reflect.DeepEqual(replayed.DeadLinks, recorded.DeadLinks) {
+		t.Errorf("Expected dead links %+v, got: %+v", recorded.DeadLinks, replayed.DeadLinks)
+	}
+	byURL := func(a, b Page) int { return strings.Compare(a.URL, b.URL) }
+	slices.SortFunc(recorded.Pages, byURL)
+	slices.SortFunc(replayed.Pages, byURL)
+	if !reflect.DeepEqual(replayed.Pages, recorded.Pages) {
+		t.Errorf("Expected pages %+v, got: %+v", recorded.Pages, replayed.Pages)
+	}
+}
+
+func TestReplayScraper_NotRecorded(t *testing.T) {
+	harPath := filepath.Join(t.TempDir(), "empty.har")
+	if err := (&harRecorder{}).save(harPath); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReplayScraper(harPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := s.Run(context.Background(), "http://example.com"); err == nil {
+		t.Errorf("Expected the unrecorded seed to fail, got no error")
+	}
+}
+
+func TestStartScraper_RecordHARCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `<html><body><a href="/">Home</a></body></html>`)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.StripUserInfo = false
+	cfg.RecordHAR = filepath.Join(t.TempDir(), "crawl.har")
+	result, err := NewScraper(cfg).Run(context.Background(), strings.Replace(ts.URL, "://", "://user:secret@", 1))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.DeadLinks) != 0 {
+		t.Fatalf("Expected no dead links, got: %+v", result.DeadLinks)
+	}
+
+	info, err := os.Stat(cfg.RecordHAR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("Expected the HAR file to be private, got mode: %v", mode)
+	}
+	content, err := os.ReadFile(cfg.RecordHAR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "Authorization") || strings.Contains(string(content), base64.StdEncoding.EncodeToString([]byte("user:secret"))) {
+		t.Errorf("Expected the HAR file to leave out the credentials, got: %s", content)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// hostBudget limits the time spent on each host, counted from the first
+// request to it.
+type hostBudget struct {
+	max time.Duration
+
+	mu    sync.Mutex
+	start map[string]time.Time
+}
+
+func newHostBudget(max time.Duration) *hostBudget {
+	return &hostBudget{max: max, start: make(map[string]time.Time)}
+}
+
+// exceeded reports whether the time for host ran out, starting its clock
+// if this is its first request.
+func (b *hostBudget) exceeded(host string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start, ok := b.start[host]
+	if !ok {
+		b.start[host] = time.Now()
+		return false
+	}
+	return time.Since(start) > b.max
+}
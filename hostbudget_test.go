@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun_MaxDurationPerHost(t *testing.T) {
+	var slowHits atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowHits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, `<html><body>Slow</body></html>`)
+	}))
+	defer slow.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		// The clock of the seed's host runs too, so its links come first.
+		var sb strings.Builder
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="/dead%d">dead</a>`, i)
+		}
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="%s/%d">slow</a>`, slow.URL, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 2
+	cfg.MaxDurationPerHost = 250 * time.Millisecond
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	hits := int(slowHits.Load())
+	if hits >= 10 {
+		t.Errorf("Expected the slow host to be cut off, got %d requests", hits)
+	}
+	if len(result.Skipped) != 10-hits {
+		t.Errorf("Expected the %d unchecked slow URLs to be skipped, got: %v", 10-hits, result.Skipped)
+	}
+	for _, u := range result.Skipped {
+		if !strings.HasPrefix(u, slow.URL) {
+			t.Errorf("Expected only slow URLs to be skipped, got %s", u)
+		}
+	}
+	if len(result.DeadLinks) != 10 {
+		t.Errorf("Expected every link of the fast host to be checked, got: %v", result.DeadLinks)
+	}
+}
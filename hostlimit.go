@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// hostConcurrency returns how many requests to u's host may be in progress
+// at once, or 0 for no limit. A HostConcurrency entry, given with or
+// without a port, wins. Otherwise DefaultHostConcurrency applies, tightened
+// to one request at a time if robots.txt asks for a Crawl-delay; rules is
+// nil unless robots.txt is respected.
+func (c *Config) hostConcurrency(u *url.URL, rules *robotsRules) int {
+	if limit, ok := c.HostConcurrency[u.Host]; ok {
+		return limit
+	}
+	if limit, ok := c.HostConcurrency[u.Hostname()]; ok {
+		return limit
+	}
+	limit := c.DefaultHostConcurrency
+	if rules != nil && rules.crawlDelay > 0 && (limit == 0 || limit > 1) {
+		limit = 1
+	}
+	return limit
+}
+
+// hostSlots bounds the requests in progress to each host.
+type hostSlots struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostSlots() *hostSlots {
+	return &hostSlots{slots: make(map[string]chan struct{})}
+}
+
+// acquire waits for one of the limit slots of host, the first limit given
+// for a host setting its number of slots. The returned release func frees
+// it, and must be called exactly once. A nil hostSlots or a limit of 0
+// means no limit.
+func (h *hostSlots) acquire(ctx context.Context, host string, limit int) (release func(), err error) {
+	if h == nil || limit <= 0 {
+		return func() {}, nil
+	}
+	h.mu.Lock()
+	slots, ok := h.slots[host]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		h.slots[host] = slots
+	}
+	h.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
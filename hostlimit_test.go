@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConfig_HostConcurrency(t *testing.T) {
+	u, _ := url.Parse("https://example.com:8443/page")
+	delayed := &robotsRules{crawlDelay: time.Second}
+	tests := []struct {
+		name     string
+		def      int
+		explicit map[string]int
+		rules    *robotsRules
+		want     int
+	}{
+		{name: "unlimited", want: 0},
+		{name: "default", def: 4, want: 4},
+		{name: "no crawl-delay", def: 4, rules: &robotsRules{}, want: 4},
+		{name: "crawl-delay tightens the default", def: 4, rules: delayed, want: 1},
+		{name: "crawl-delay tightens no limit", rules: delayed, want: 1},
+		{name: "explicit wins over robots.txt", def: 4, explicit: map[string]int{"example.com": 3}, rules: delayed, want: 3},
+		{name: "explicit with port wins", explicit: map[string]int{"example.com": 3, "example.com:8443": 2}, want: 2},
+		{name: "explicit for another host", def: 4, explicit: map[string]int{"other.com": 8}, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{DefaultHostConcurrency: tt.def, HostConcurrency: tt.explicit}
+			if got := cfg.hostConcurrency(u, tt.rules); got != tt.want {
+				t.Errorf("Expected a limit of %d, got: %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStartScraper_DefaultHostConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		if r.URL.Path != "/" {
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(w, `<html><body>Page</body></html>`)
+			return
+		}
+		var sb strings.Builder
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.DefaultHostConcurrency = 2
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("Expected at most 2 requests at once, got: %d", got)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HreflangIssue is a language alternate that does not link back to the page
+// declaring it.
+type HreflangIssue struct {
+	// Page declares Alternate as one of its language variants.
+	Page      string `json:"page"`
+	Alternate string `json:"alternate"`
+}
+
+// isHreflang reports whether n is a <link rel="alternate" hreflang="...">.
+func isHreflang(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "link" || attrValue(n, "hreflang") == "" || attrValue(n, "href") == "" {
+		return false
+	}
+	return slices.Contains(strings.Fields(strings.ToLower(attrValue(n, "rel"))), "alternate")
+}
+
+// missingReciprocity returns the alternates that were crawled but do not
+// declare their page as an alternate in return, given the hreflang
+// alternates of each crawled page.
+func missingReciprocity(alternates map[string][]string, logger *slog.Logger) []HreflangIssue {
+	var issues []HreflangIssue
+	for page, pageAlternates := range alternates {
+		for _, alternate := range pageAlternates {
+			back, crawled := alternates[alternate]
+			if alternate == page || !crawled || slices.Contains(back, page) {
+				continue
+			}
+			logger.Info(fmt.Sprintf("%s does not link back to %s with hreflang", alternate, page))
+			issues = append(issues, HreflangIssue{Page: page, Alternate: alternate})
+		}
+	}
+	slices.SortFunc(issues, func(a, b HreflangIssue) int {
+		return cmp.Or(cmp.Compare(a.Page, b.Page), cmp.Compare(a.Alternate, b.Alternate))
+	})
+	return issues
+}
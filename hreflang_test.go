@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestRun_Hreflang(t *testing.T) {
+	alternates := func(paths ...string) string {
+		var links string
+		for i, path := range paths {
+			links += fmt.Sprintf(`<link rel="alternate" hreflang="l%d" href="%s">`, i, path)
+		}
+		return links
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/en":
+			fmt.Fprintf(w, `<html><head>%s</head><body>English</body></html>`, alternates("/en", "/fr", "/de", "/es"))
+		case "/fr":
+			fmt.Fprintf(w, `<html><head>%s</head><body>Français</body></html>`, alternates("/en", "/fr"))
+		case "/de":
+			// No way back to /en.
+			fmt.Fprintf(w, `<html><head>%s</head><body>Deutsch</body></html>`, alternates("/de"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.CheckHreflangReciprocity = true
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/en")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(result.DeadLinks) != 1 || result.DeadLinks[0].URL != ts.URL+"/es" || result.DeadLinks[0].Rel != "alternate" {
+		t.Errorf("Expected the missing alternate to be reported dead, got: %v", result.DeadLinks)
+	}
+	want := []HreflangIssue{{Page: ts.URL + "/en", Alternate: ts.URL + "/de"}}
+	if !slices.Equal(result.HreflangIssues, want) {
+		t.Errorf("Expected hreflang issues %v, got %v", want, result.HreflangIssues)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// humanizer waits a random time before each request, per
+// Config.HumanizeDelay, so that requests do not arrive at regular
+// intervals. A nil humanizer never waits.
+type humanizer struct {
+	max time.Duration
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// newHumanizer returns a humanizer waiting up to maxDelay. The delays are drawn
+// from seed, or from a random seed if it is zero.
+func newHumanizer(maxDelay time.Duration, seed uint64) *humanizer {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &humanizer{max: maxDelay, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// delay returns the next delay, uniformly distributed in [0, max].
+func (h *humanizer) delay() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.rng.Int64N(int64(h.max) + 1))
+}
+
+// wait blocks for the next delay, or until ctx is done.
+func (h *humanizer) wait(ctx context.Context) error {
+	return sleep(ctx, h.delay())
+}
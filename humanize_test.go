@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHumanizer(t *testing.T) {
+	const maxDelay = 50 * time.Millisecond
+	h := newHumanizer(maxDelay, 42)
+	var delays []time.Duration
+	for range 1000 {
+		d := h.delay()
+		if d < 0 || d > maxDelay {
+			t.Fatalf("Expected delays in [0, %s], got %s", maxDelay, d)
+		}
+		delays = append(delays, d)
+	}
+	if slices.Min(delays) > maxDelay/10 || slices.Max(delays) < maxDelay*9/10 {
+		t.Errorf("Expected delays to spread over [0, %s], got [%s, %s]", maxDelay, slices.Min(delays), slices.Max(delays))
+	}
+
+	// The same seed gives the same delays.
+	again := newHumanizer(maxDelay, 42)
+	for i, want := range delays {
+		if got := again.delay(); got != want {
+			t.Fatalf("Delay %d: expected %s with the same seed, got %s", i, want, got)
+		}
+	}
+
+	var disabled *humanizer
+	if d := disabled.delay(); d != 0 {
+		t.Errorf("Expected no delay when disabled, got %s", d)
+	}
+}
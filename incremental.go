@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// previousCrawl indexes Config.Previous for incremental crawls.
+type previousCrawl struct {
+	pages map[string]Page
+	// deadLinks maps a referrer to the dead links found on it.
+	deadLinks map[string][]DeadLink
+}
+
+func newPreviousCrawl(result *Result) *previousCrawl {
+	previous := &previousCrawl{
+		pages:     make(map[string]Page, len(result.Pages)),
+		deadLinks: make(map[string][]DeadLink),
+	}
+	for _, page := range result.Pages {
+		previous.pages[page.URL] = page
+	}
+	for _, deadLink := range result.DeadLinks {
+		previous.deadLinks[deadLink.Referrer] = append(previous.deadLinks[deadLink.Referrer], deadLink)
+	}
+	return previous
+}
+
+// setConditional makes req for u conditional on the page having changed
+// since the previous crawl.
+func (p *previousCrawl) setConditional(req *http.Request, u *url.URL) {
+	if p == nil {
+		return
+	}
+	page, ok := p.pages[u.String()]
+	if !ok {
+		return
+	}
+	if page.ETag != "" {
+		req.Header.Set("If-None-Match", page.ETag)
+	}
+	if !page.LastModified.IsZero() {
+		req.Header.Set("If-Modified-Since", page.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// reuse carries the previous outcome of the unchanged scraped page forward.
+// Its dead links are reported again without being fetched, and the pages it
+// links to are queued so that they are checked for changes too. Its other
+// links are assumed to still be alive.
+func (data *ScrapeData) reuse() {
+	previous, ok := data.previous.pages[data.job.url.String()]
+	if !ok {
+		data.log().Warn(fmt.Sprintf("Unexpected 304 for %s", data.job.url))
+		return
+	}
+	data.log().Info(fmt.Sprintf("Not modified, reusing previous results: %s", data.job.url))
+	data.collector.addPage(previous)
+
+	batch := make([]*job, 0)
+	for _, deadLink := range data.previous.deadLinks[previous.URL] {
+		u, err := cleanURL(deadLink.URL, nil)
+		if err != nil {
+			continue
+		}
+		batch = append(batch, &job{
+			url:        u,
+			referrer:   data.job.url,
+			anchorText: deadLink.AnchorText,
+			rel:        deadLink.Rel,
+			previous:   &deadLink,
+			depth:      data.job.depth + 1,
+		})
+	}
+	for _, href := range previous.Links {
+		if _, ok := data.previous.pages[href]; !ok {
+			continue
+		}
+		u, err := cleanURL(href, nil)
+		if err != nil {
+			continue
+		}
+		batch = append(batch, &job{url: u, referrer: data.job.url, depth: data.job.depth + 1})
+	}
+	if len(batch) == 0 {
+		return
+	}
+	data.wg.Add(len(batch))
+	data.nextlinks <- batch
+}
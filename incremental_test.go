@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestRun_Previous(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	notModified := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/", "/about":
+			etag := fmt.Sprintf(`"%s-v1"`, r.URL.Path)
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				notModified[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			if r.URL.Path == "/" {
+				fmt.Fprintf(w, `<html><body><a href="/about">About</a><a href="/dead">Dead</a></body></html>`)
+			} else {
+				fmt.Fprintf(w, `<html><body><a href="/gone">Gone</a></body></html>`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	first, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	mu.Lock()
+	clear(requests)
+	mu.Unlock()
+	cfg.Previous = &first
+	second, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if notModified["/"] != 1 || notModified["/about"] != 1 {
+		t.Errorf("Expected both pages to be fetched conditionally, got 304s: %v", notModified)
+	}
+	if requests["/dead"] != 0 || requests["/gone"] != 0 {
+		t.Errorf("Expected links of unchanged pages not to be fetched again, got requests: %v", requests)
+	}
+	for _, path := range []string{"/dead", "/gone"} {
+		deadLink := findDeadLink(second.DeadLinks, ts.URL+path)
+		if deadLink == nil {
+			t.Errorf("Expected previous dead link %s to be reused, got: %v", path, second.DeadLinks)
+			continue
+		}
+		if deadLink.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected previous status %d for %s, got %d", http.StatusNotFound, path, deadLink.StatusCode)
+		}
+	}
+	pages := make([]string, 0, len(second.Pages))
+	for _, page := range second.Pages {
+		pages = append(pages, page.URL)
+	}
+	slices.Sort(pages)
+	if want := []string{ts.URL, ts.URL + "/about"}; !slices.Equal(pages, want) {
+		t.Errorf("Expected unchanged pages %v to be kept, got %v", want, pages)
+	}
+}
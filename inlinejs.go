@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// jsURLPattern matches the string literals of a script that look like URLs:
+// absolute http(s) URLs and root-relative paths.
+var jsURLPattern = regexp.MustCompile(`["'` + "`" + `]((?:https?:)?//[^"'` + "`" + `\s]+|/[^/"'` + "`" + `\s][^"'` + "`" + `\s]*)["'` + "`" + `]`)
+
+// jsURLs returns the string literals of a script that look like URLs.
+// This is a heuristic for Config.ScanInlineJS: it misses URLs built at run
+// time and may pick up strings that are not links.
+func jsURLs(js string) []string {
+	var urls []string
+	for _, match := range jsURLPattern.FindAllStringSubmatch(js, -1) {
+		urls = append(urls, match[1])
+	}
+	return urls
+}
+
+// inlineJS returns the inline scripts of n: its event handler attributes,
+// a javascript: href, and the body of a <script> without src.
+func inlineJS(n *html.Node) []string {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	var scripts []string
+	for _, attr := range n.Attr {
+		switch {
+		case strings.HasPrefix(attr.Key, "on"):
+			scripts = append(scripts, attr.Val)
+		case attr.Key == "href" && strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:"):
+			scripts = append(scripts, attr.Val)
+		}
+	}
+	if n.Data == "script" && attrValue(n, "src") == "" && isJSType(attrValue(n, "type")) &&
+		n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+		scripts = append(scripts, n.FirstChild.Data)
+	}
+	return scripts
+}
+
+// isJSType reports whether a <script> type attribute denotes JavaScript.
+func isJSType(typ string) bool {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "", "text/javascript", "application/javascript", "module":
+		return true
+	}
+	return false
+}
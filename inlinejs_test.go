@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestJSURLs(t *testing.T) {
+	js := `location.href='/next'; fetch("https://example.com/api"); go("https://other.com/x");
+		var re = /a/; var s = "//example.com/cdn.js"; var c = '// comment'; var d = "/";`
+	want := []string{"/next", "https://example.com/api", "https://other.com/x", "//example.com/cdn.js"}
+	if got := jsURLs(js); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestStartScraper_ScanInlineJS(t *testing.T) {
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<button onclick="location.href='/missing'">Next</button>
+				<button onclick="window.open('%s/gone')">Elsewhere</button>
+				<script>var home = "/live";</script>
+				<script type="application/ld+json">{"x": "/ignored"}</script>
+			</body></html>`, other.URL)
+		case "/live":
+			fmt.Fprint(w, `<html><body>Live</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	if deadLinks, err := StartScraperWithConfig(ts.URL, cfg); err != nil || len(deadLinks) != 0 {
+		t.Fatalf("Expected inline scripts to be ignored by default, got: %v, %v", deadLinks, err)
+	}
+
+	cfg.ScanInlineJS = true
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 2 || findDeadLink(deadLinks, ts.URL+"/missing") == nil || findDeadLink(deadLinks, other.URL+"/gone") == nil {
+		t.Errorf("Expected the onclick URLs to be reported dead, got: %+v", deadLinks)
+	}
+}
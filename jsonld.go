@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// jsonLDKeys are the JSON-LD properties whose values are followed as links.
+var jsonLDKeys = map[string]bool{"url": true, "sameAs": true}
+
+// jsonLDURLs returns the values of the jsonLDKeys properties found anywhere
+// in a JSON-LD document.
+func jsonLDURLs(text string, logger *slog.Logger) []string {
+	var doc any
+	if err := json.Unmarshal([]byte(text), &doc); err != nil {
+		logger.Warn(fmt.Sprintf("Could not parse JSON-LD: %s", err.Error()))
+		return nil
+	}
+
+	var urls []string
+	var walk func(v any, linked bool)
+	walk = func(v any, linked bool) {
+		switch v := v.(type) {
+		case map[string]any:
+			// Keys are sorted so that links keep a stable order.
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				walk(v[key], jsonLDKeys[key])
+			}
+		case []any:
+			for _, child := range v {
+				walk(child, linked)
+			}
+		case string:
+			if linked && v != "" {
+				urls = append(urls, v)
+			}
+		}
+	}
+	walk(doc, false)
+	return urls
+}
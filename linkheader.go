@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// paginationLinks returns the next, prev and last links of Link header
+// values, as in `<https://api.example.com/items?page=2>; rel="next"`,
+// resolved against base. Unlike links found in pages, they keep their query,
+// which usually holds the page number.
+func paginationLinks(values []string, base *url.URL, logger *slog.Logger) []link {
+	var links []link
+	for _, value := range values {
+		for _, entry := range splitLinkHeader(value) {
+			target, params, ok := strings.Cut(entry, ">")
+			target = strings.TrimSpace(target)
+			if !ok || !strings.HasPrefix(target, "<") {
+				continue
+			}
+			if !isPaginationRel(linkParam(params, "rel")) {
+				continue
+			}
+			u, err := url.Parse(target[1:])
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to parse Link header URL: %s", err.Error()))
+				continue
+			}
+			u = base.ResolveReference(u)
+			u.Fragment = ""
+			links = append(links, link{url: u})
+		}
+	}
+	return links
+}
+
+// splitLinkHeader splits a Link header value into its links. Commas inside
+// <...> or quoted parameters do not separate links.
+func splitLinkHeader(value string) []string {
+	var entries []string
+	inURL, inQuotes := false, false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '<' && !inQuotes:
+			inURL = true
+		case c == '>' && !inQuotes:
+			inURL = false
+		case c == '"' && !inURL:
+			inQuotes = !inQuotes
+		case c == ',' && !inURL && !inQuotes:
+			entries = append(entries, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(entries, value[start:])
+}
+
+// linkParam returns the value of the parameter name in the parameters of a
+// Link header entry, like `; rel="next"; title="Next"`, unquoted.
+func linkParam(params, name string) string {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// isPaginationRel reports whether a rel parameter, which may hold several
+// space-separated relations, names another page of a paginated list.
+func isPaginationRel(rel string) bool {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		switch token {
+		case "next", "prev", "previous", "last":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestPaginationLinks(t *testing.T) {
+	base, _ := url.Parse("https://api.example.com/items?page=2")
+	values := []string{
+		`<https://api.example.com/items?page=3>; rel="next", </items?page=1>; rel=prev`,
+		`<https://api.example.com/items?page=9&sort=a,b>; title="Last, really"; rel="last"`,
+		`<https://example.com/docs>; rel="help", </items#top>; rel="first"`,
+	}
+	var got []string
+	for _, l := range paginationLinks(values, base, slog.Default()) {
+		got = append(got, l.url.String())
+	}
+	want := []string{
+		"https://api.example.com/items?page=3",
+		"https://api.example.com/items?page=1",
+		"https://api.example.com/items?page=9&sort=a,b",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected links %v, got %v", want, got)
+	}
+}
+
+func TestStartScraper_FollowLinkHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page > 3 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+		if page > 1 {
+			w.Header().Add("Link", fmt.Sprintf(`</items?page=%d>; rel="prev"`, page-1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"page": %d, "items": []}`, page)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	deadLinks, err := StartScraperWithConfig(ts.URL+"/items", cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected Link headers to be ignored by default, got: %v", deadLinks)
+	}
+
+	cfg.FollowLinkHeader = true
+	if deadLinks, err = StartScraperWithConfig(ts.URL+"/items", cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 1 || deadLinks[0].URL != ts.URL+"/items?page=4" {
+		t.Errorf("Expected the chain to be walked to its dead end, got: %v", deadLinks)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxPaceFactor bounds the spacing a latencyPacer imposes, in multiples of
+// its target.
+const maxPaceFactor = 20
+
+// latencyPacer spaces out requests to each host so that its response times
+// stay near a target, for Config.LatencyTargetMillis. A response slower
+// than the target doubles the spacing of its host; a faster one shrinks it
+// by a quarter, down to none.
+type latencyPacer struct {
+	target time.Duration
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	delay map[string]time.Duration
+	// raised is when the spacing of each host was last doubled. Requests
+	// sent before then were spaced less, so they do not double it again.
+	raised map[string]time.Time
+}
+
+func newLatencyPacer(target time.Duration, logger *slog.Logger) *latencyPacer {
+	return &latencyPacer{target: target, logger: logger, delay: make(map[string]time.Duration), raised: make(map[string]time.Time)}
+}
+
+// observe adjusts the spacing of host to a response to a request sent at
+// start.
+func (p *latencyPacer) observe(host string, start time.Time) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	latency := now.Sub(start)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delay := p.delay[host]
+	switch {
+	case latency <= p.target:
+		if delay = delay * 3 / 4; delay < p.target/10 {
+			delay = 0
+		}
+	case start.After(p.raised[host]):
+		delay = min(max(2*delay, p.target), maxPaceFactor*p.target)
+		p.raised[host] = now
+		p.logger.Debug(fmt.Sprintf("%s answered in %s, spacing requests by %s", host, latency, delay))
+	}
+	p.delay[host] = delay
+}
+
+// spacing returns the delay to leave between requests to host.
+func (p *latencyPacer) spacing(host string) time.Duration {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.delay[host]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyPacer(t *testing.T) {
+	p := newLatencyPacer(10*time.Millisecond, slog.Default())
+	p.observe("a", time.Now())
+	if got := p.spacing("a"); got != 0 {
+		t.Errorf("Expected no spacing while fast, got: %s", got)
+	}
+	p.observe("a", time.Now().Add(-50*time.Millisecond))
+	if got, want := p.spacing("a"), 10*time.Millisecond; got != want {
+		t.Errorf("Expected a spacing of %s after a slow response, got: %s", want, got)
+	}
+	// A request sent before the spacing grew does not grow it again.
+	p.observe("a", time.Now().Add(-50*time.Millisecond))
+	if got, want := p.spacing("a"), 10*time.Millisecond; got != want {
+		t.Errorf("Expected the spacing to stay %s, got: %s", want, got)
+	}
+	if got := p.spacing("b"); got != 0 {
+		t.Errorf("Expected other hosts to be unaffected, got: %s", got)
+	}
+	for range 10 {
+		p.raised["a"] = time.Time{}
+		p.observe("a", time.Now().Add(-time.Second))
+	}
+	if got, want := p.spacing("a"), maxPaceFactor*10*time.Millisecond; got != want {
+		t.Errorf("Expected the spacing to be capped at %s, got: %s", want, got)
+	}
+	for range 100 {
+		p.observe("a", time.Now())
+	}
+	if got := p.spacing("a"); got != 0 {
+		t.Errorf("Expected the spacing to go once fast again, got: %s", got)
+	}
+}
+
+func TestStartScraper_LatencyTargetMillis(t *testing.T) {
+	// The server slows down with every request it serves at once.
+	var active atomic.Int32
+	var mu sync.Mutex
+	var latencies []time.Duration
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		latency := time.Duration(n) * 10 * time.Millisecond
+		time.Sleep(latency)
+		mu.Lock()
+		latencies = append(latencies, latency)
+		mu.Unlock()
+		if r.URL.Path != "/" {
+			fmt.Fprint(w, `<html><body>Page</body></html>`)
+			return
+		}
+		var sb strings.Builder
+		for i := range 20 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	// meanLatency crawls and returns the mean latency of the second half of
+	// the requests, once pacing had time to adjust.
+	meanLatency := func(cfg Config) time.Duration {
+		mu.Lock()
+		latencies = nil
+		mu.Unlock()
+		if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		var total time.Duration
+		late := latencies[len(latencies)/2:]
+		for _, latency := range late {
+			total += latency
+		}
+		return total / time.Duration(len(late))
+	}
+
+	cfg := DefaultConfig()
+	cfg.Workers = 5
+	unpaced := meanLatency(cfg)
+	cfg.LatencyTargetMillis = 15
+	paced := meanLatency(cfg)
+	if paced >= unpaced/2 {
+		t.Errorf("Expected pacing to relax the server, got a mean latency of %s paced and %s unpaced", paced, unpaced)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "sync"
+
+// workerPool runs a resizable set of workers.
+type workerPool struct {
+	mu sync.Mutex
+	// quits holds one channel per running worker. Closing it tells that
+	// worker to exit once it has finished its current job.
+	quits []chan struct{}
+	run   func(quit <-chan struct{})
+	// running counts the workers that have not exited yet. Once stopped,
+	// no worker is started.
+	running sync.WaitGroup
+	stopped bool
+}
+
+func newWorkerPool(run func(quit <-chan struct{})) *workerPool {
+	return &workerPool{run: run}
+}
+
+// scale starts or stops workers until n are running. At least one worker
+// is always kept, so that a crawl cannot stall.
+func (p *workerPool) scale(n int) {
+	n = max(n, 1)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	for len(p.quits) < n {
+		quit := make(chan struct{})
+		p.quits = append(p.quits, quit)
+		p.running.Add(1)
+		go func() {
+			defer p.running.Done()
+			p.run(quit)
+		}()
+	}
+	for len(p.quits) > n {
+		close(p.quits[len(p.quits)-1])
+		p.quits = p.quits[:len(p.quits)-1]
+	}
+}
+
+// size returns the number of running workers.
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.quits)
+}
+
+// stop tells every worker to exit, and waits until they have. Scale has no
+// effect afterwards.
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	for _, quit := range p.quits {
+		close(quit)
+	}
+	p.quits = nil
+	p.mu.Unlock()
+	p.running.Wait()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"container/heap"
+	"net/url"
+)
+
+// priorityFrontier is the Frontier used with Config.Priority. It pops the
+// job with the highest priority first, and jobs of the same priority in the
+// order they were found.
+type priorityFrontier struct {
+	priority func(u *url.URL, depth int) int
+	jobs     jobHeap
+	seq      uint64
+}
+
+func newPriorityFrontier(priority func(u *url.URL, depth int) int) *priorityFrontier {
+	return &priorityFrontier{priority: priority}
+}
+
+func (f *priorityFrontier) Push(j *Job) {
+	// A job pushed back keeps its place among jobs of the same priority.
+	if j.seq == 0 {
+		f.seq++
+		j.seq = f.seq
+	}
+	heap.Push(&f.jobs, prioritized{job: j, priority: f.priority(j.URL, j.Depth)})
+}
+
+func (f *priorityFrontier) Pop() (*Job, bool) {
+	if len(f.jobs) == 0 {
+		return nil, false
+	}
+	return heap.Pop(&f.jobs).(prioritized).job, true
+}
+
+func (f *priorityFrontier) Len() int {
+	return len(f.jobs)
+}
+
+type prioritized struct {
+	job      *Job
+	priority int
+}
+
+// jobHeap implements heap.Interface, with the highest priority first.
+type jobHeap []prioritized
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].job.seq < h[j].job.seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(prioritized)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	old[len(old)-1] = prioritized{}
+	*h = old[:len(old)-1]
+	return last
+}
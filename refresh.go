@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// isMetaRefresh reports whether n is a <meta http-equiv="refresh"> element.
+func isMetaRefresh(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Data == "meta" &&
+		strings.EqualFold(attrValue(n, "http-equiv"), "refresh")
+}
+
+// parseMetaRefresh returns the URL of a refresh declaration such as
+// "5; url='/next'", parsed the way the HTML standard does. It returns "" if
+// the declaration is invalid or only reloads the page.
+func parseMetaRefresh(content string) string {
+	rest := strings.TrimLeft(content, " \t\n\r\f")
+	afterDelay := strings.TrimLeft(rest, "0123456789.")
+	if afterDelay == rest {
+		return ""
+	}
+	// The delay must be followed by a separator.
+	if afterDelay != "" && !strings.ContainsRune(" \t\n\r\f;,", rune(afterDelay[0])) {
+		return ""
+	}
+	rest = strings.TrimLeft(afterDelay, " \t\n\r\f")
+	if rest != "" && (rest[0] == ';' || rest[0] == ',') {
+		rest = strings.TrimLeft(rest[1:], " \t\n\r\f")
+	}
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		after := strings.TrimLeft(rest[3:], " \t\n\r\f")
+		if strings.HasPrefix(after, "=") {
+			rest = strings.TrimLeft(after[1:], " \t\n\r\f")
+		}
+	}
+	if rest != "" && (rest[0] == '\'' || rest[0] == '"') {
+		quote := rest[0]
+		rest = rest[1:]
+		if end := strings.IndexByte(rest, quote); end >= 0 {
+			rest = rest[:end]
+		}
+	}
+	return strings.TrimSpace(rest)
+}
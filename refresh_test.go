@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseMetaRefresh(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"5;url=/next", "/next"},
+		{"0; URL='/quoted page'", "/quoted page"},
+		{` 3 , url = "/spaced" `, "/spaced"},
+		{"1.5; /bare", "/bare"},
+		{"0;url=https://example.com/?a=1", "https://example.com/?a=1"},
+		{"5", ""},
+		{"5;", ""},
+		{"url=/no-delay", ""},
+		{"5x;url=/bad", ""},
+	}
+	for _, tt := range tests {
+		if got := parseMetaRefresh(tt.content); got != tt.want {
+			t.Errorf("parseMetaRefresh(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestStartScraper_FollowMetaRefresh(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><meta http-equiv="Refresh" content="0; url=/moved"></head><body><a href="/old">Old</a></body></html>`)
+		case "/old":
+			fmt.Fprint(w, `<html><head><meta http-equiv="refresh" content="0;url=/missing"></head><body>Old</body></html>`)
+		case "/moved":
+			fmt.Fprint(w, `<html><head><meta http-equiv="refresh" content="5;url=/gone"></head><body>Moved</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// Refresh targets are checked, but not crawled.
+	deadLink := findDeadLink(deadLinks, ts.URL+"/missing")
+	if len(deadLinks) != 1 || deadLink == nil || deadLink.Referrer != ts.URL+"/old" || deadLink.Rel != "refresh" {
+		t.Errorf("Expected only the dead refresh target of a crawled page to be reported, got: %+v", deadLinks)
+	}
+
+	cfg.FollowMetaRefresh = true
+	if deadLinks, err = StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	deadLink = findDeadLink(deadLinks, ts.URL+"/gone")
+	if deadLink == nil || deadLink.Referrer != ts.URL+"/moved" || deadLink.Rel != "refresh" {
+		t.Errorf("Expected the refresh target of the crawled target to be reported, got: %+v", deadLinks)
+	}
+}
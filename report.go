@@ -0,0 +1,294 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportFunc writes a report of result to w, like ReportJSON.
+type ReportFunc func(w io.Writer, result Result) error
+
+// ReportJSON writes the dead links of result to w as an indented JSON array.
+func ReportJSON(w io.Writer, result Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result.DeadLinks)
+}
+
+// ReportCSV writes the dead links of result to w as CSV, with a header row.
+func ReportCSV(w io.Writer, result Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"url", "referrer", "anchor_text", "status_code", "kind", "error", "reason"})
+	for _, deadLink := range result.DeadLinks {
+		statusCode := ""
+		if deadLink.StatusCode != 0 {
+			statusCode = strconv.Itoa(deadLink.StatusCode)
+		}
+		cw.Write([]string{
+			deadLink.URL,
+			deadLink.Referrer,
+			deadLink.AnchorText,
+			statusCode,
+			string(deadLink.Kind),
+			deadLink.Error,
+			deadLink.Reason,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReportBrokenFragmentsCSV writes the broken fragment links of result to w
+// as CSV, with a header row, grouped by the page they are found on so that
+// pages can be fixed one at a time. Config.CheckFragments must be set for
+// the result to list any.
+func ReportBrokenFragmentsCSV(w io.Writer, result Result) error {
+	broken := slices.Clone(result.BrokenFragments)
+	slices.SortStableFunc(broken, func(a, b BrokenFragment) int {
+		return strings.Compare(a.Referrer, b.Referrer)
+	})
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"source_page", "fragment", "target_page", "reason"})
+	for _, fragment := range broken {
+		cw.Write([]string{fragment.Referrer, fragment.Fragment, fragment.URL, string(fragment.Reason)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReportGitHubActions writes the dead links of result to w as GitHub Actions
+// error annotations, so that a workflow step shows them in its checks. Dead
+// links are not tied to source files, so the page linking to one is named in
+// the annotation title instead.
+func ReportGitHubActions(w io.Writer, result Result) error {
+	for _, deadLink := range result.DeadLinks {
+		title := "Dead link"
+		if deadLink.Referrer != "" {
+			title += " on " + deadLink.Referrer
+		}
+		message := deadLink.URL + ": " + deadLinkProblem(deadLink)
+		if deadLink.AnchorText != "" {
+			message += fmt.Sprintf(" (anchor %q)", deadLink.AnchorText)
+		}
+		_, err := fmt.Fprintf(w, "::error title=%s::%s\n", annotationProperty.Replace(title), annotationData.Replace(message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportMarkdown writes result to w as a Markdown summary, with a table of
+// dead links for each status code, for pasting into issues or pull
+// requests.
+func ReportMarkdown(w io.Writer, result Result) error {
+	var b strings.Builder
+	b.WriteString("# Dead links\n\n")
+	fmt.Fprintf(&b, "Crawled %d pages in %s and found %d dead links.\n", len(result.Pages), result.Duration.Round(time.Millisecond), len(result.DeadLinks))
+	if len(result.DeadLinks) == 0 {
+		b.WriteString("\nNo dead links found 🎉\n")
+	}
+
+	groups := make(map[int][]DeadLink)
+	for _, deadLink := range result.DeadLinks {
+		groups[deadLink.StatusCode] = append(groups[deadLink.StatusCode], deadLink)
+	}
+	// Links without a response come last.
+	codes := slices.Sorted(maps.Keys(groups))
+	if len(codes) > 0 && codes[0] == 0 {
+		codes = append(codes[1:], 0)
+	}
+	for _, code := range codes {
+		heading := "No response"
+		if code != 0 {
+			heading = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		}
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", heading, len(groups[code]))
+		b.WriteString("| URL | Status | Referrer |\n| --- | --- | --- |\n")
+		for _, deadLink := range groups[code] {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownCell(deadLink.URL), markdownCell(deadLinkProblem(deadLink)), markdownCell(deadLink.Referrer))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// atomFeed and atomEntry are the parts of an Atom feed written by
+// ReportAtom.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    *atomLink   `xml:"link,omitempty"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// ReportAtom writes the dead links of result to w as an Atom feed, one
+// entry per dead link, for feed readers and monitoring dashboards. The feed
+// and entry IDs only depend on the seed and the links, so that a reader
+// polling successive crawls sees each dead link once. The feed is updated
+// when the last dead link was found, or at the zero time if there is none,
+// so that the same result always gives the same feed.
+func ReportAtom(w io.Writer, result Result) error {
+	feed := atomFeed{
+		ID:     atomID(result.Seed),
+		Title:  "Dead links",
+		Author: atomAuthor{Name: "scraper"},
+	}
+	if result.Seed != "" {
+		feed.Title += " of " + result.Seed
+		feed.Link = &atomLink{Href: result.Seed}
+	}
+	var updated time.Time
+	for _, deadLink := range result.DeadLinks {
+		if deadLink.FoundAt.After(updated) {
+			updated = deadLink.FoundAt
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	for _, deadLink := range result.DeadLinks {
+		found := deadLink.FoundAt
+		if found.IsZero() {
+			found = updated
+		}
+		summary := deadLinkProblem(deadLink)
+		if deadLink.Referrer != "" {
+			summary += ", linked from " + deadLink.Referrer
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      atomID(result.Seed + "\n" + deadLink.URL + "\n" + deadLink.Referrer),
+			Title:   "Dead link: " + deadLink.URL,
+			Updated: found.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: deadLink.URL},
+			Summary: summary,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// atomID returns a name-based UUID URN for name, as Atom IDs must be
+// permanent and unique.
+func atomID(name string) string {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// markdownCell escapes s for a cell of a Markdown table.
+var markdownCell = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ").Replace
+
+// deadLinkProblem describes in a few words why deadLink is dead.
+func deadLinkProblem(deadLink DeadLink) string {
+	switch {
+	case deadLink.StatusCode != 0:
+		return fmt.Sprintf("status %d %s", deadLink.StatusCode, http.StatusText(deadLink.StatusCode))
+	case deadLink.Reason != "":
+		return string(deadLink.Kind) + ": " + deadLink.Reason
+	case deadLink.Error != "":
+		return deadLink.Error
+	default:
+		return string(deadLink.Kind)
+	}
+}
+
+// annotationData escapes the message of a workflow command.
+var annotationData = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// annotationProperty escapes a property of a workflow command, which also
+// cannot contain the separators of the command.
+var annotationProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// Gzip returns a report that writes the output of report gzip-compressed.
+func Gzip(report ReportFunc) ReportFunc {
+	return func(w io.Writer, result Result) error {
+		zw := gzip.NewWriter(w)
+		if err := report(zw, result); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+}
+
+// WriteReportFile writes report to the file at path, replacing it. The
+// report is gzip-compressed if result.CompressReport is set or path ends in
+// ".gz".
+func WriteReportFile(path string, result Result, report ReportFunc) error {
+	if result.CompressReport || strings.HasSuffix(path, ".gz") {
+		report = Gzip(report)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(report(f, result), f.Close())
+}
+
+// streamWriter writes dead links to w as they are found, one JSON object per
+// line. It must only be used from one goroutine.
+type streamWriter struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func newStreamWriter(w io.Writer) *streamWriter {
+	return &streamWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+// write encodes deadLink and flushes w, if it buffers, so that the line is
+// seen by consumers right away.
+func (s *streamWriter) write(deadLink *DeadLink) error {
+	if err := s.enc.Encode(deadLink); err != nil {
+		return err
+	}
+	switch w := s.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case http.Flusher:
+		w.Flush()
+	}
+	return nil
+}
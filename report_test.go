@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportJSON(t *testing.T) {
+	deadLinks := []DeadLink{
+		{
+			URL:        "https://example.com/down",
+			Referrer:   "https://example.com/",
+			StatusCode: http.StatusServiceUnavailable,
+			Headers:    http.Header{"Server": {"cloudflare"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ReportJSON(&buf, Result{DeadLinks: deadLinks}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var decoded []DeadLink
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Report is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("Expected 1 dead link, got %d", len(decoded))
+	}
+	if got := decoded[0].Headers.Get("Server"); got != "cloudflare" {
+		t.Errorf("Expected Server header %q in report, got %q", "cloudflare", got)
+	}
+	if decoded[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d in report, got %d", http.StatusServiceUnavailable, decoded[0].StatusCode)
+	}
+}
+
+func TestStartScraper_StreamWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead1">One</a><a href="/dead2">Two</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// The buffered writer is never flushed by the test, so lines only show
+	// up if the scraper flushes them.
+	var buf bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.StreamWriter = bufio.NewWriter(&buf)
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var streamed []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var deadLink DeadLink
+		if err := json.Unmarshal([]byte(line), &deadLink); err != nil {
+			t.Fatalf("Line is not valid JSON: %v\n%s", err, line)
+		}
+		streamed = append(streamed, deadLink.URL)
+	}
+	slices.Sort(streamed)
+	if want := []string{ts.URL + "/dead1", ts.URL + "/dead2"}; !slices.Equal(streamed, want) {
+		t.Errorf("Expected streamed dead links %v, got %v", want, streamed)
+	}
+	if len(deadLinks) != 2 {
+		t.Errorf("Expected dead links to still be returned, got: %v", deadLinks)
+	}
+}
+
+func TestStartScraper_CompressReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// The stream stays plain JSON lines, only the report is compressed.
+	var stream bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.StreamWriter = &stream
+	cfg.CompressReport = true
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var deadLink DeadLink
+	if err := json.Unmarshal(stream.Bytes(), &deadLink); err != nil || deadLink.URL != ts.URL+"/dead" {
+		t.Errorf("Expected an uncompressed stream, got: %q, %v", stream.String(), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReportFile(path, result, ReportJSON); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Expected a gzip report, got: %v", err)
+	}
+	var deadLinks []DeadLink
+	if err := json.NewDecoder(zr).Decode(&deadLinks); err != nil || len(deadLinks) != 1 {
+		t.Errorf("Expected the dead link in the report, got: %+v, %v", deadLinks, err)
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	result := Result{DeadLinks: []DeadLink{
+		{URL: "https://example.com/missing", Referrer: "https://example.com/", AnchorText: "Missing, really", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus},
+		{URL: "https://down.example/", Referrer: "https://example.com/", Kind: KindNetworkError, Error: "connection refused"},
+	}}
+	var buf bytes.Buffer
+	if err := ReportCSV(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Report is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"url", "referrer", "anchor_text", "status_code", "kind", "error", "reason"},
+		{"https://example.com/missing", "https://example.com/", "Missing, really", "404", "http_status", "", ""},
+		{"https://down.example/", "https://example.com/", "", "", "network_error", "connection refused", ""},
+	}
+	if !slices.EqualFunc(records, want, slices.Equal[[]string]) {
+		t.Errorf("Expected records %q, got %q", want, records)
+	}
+}
+
+func TestReportBrokenFragmentsCSV(t *testing.T) {
+	result := Result{BrokenFragments: []BrokenFragment{
+		{URL: "https://example.com/a", Fragment: "intro", Referrer: "https://example.com/c", Reason: FragmentAnchorMissing},
+		{URL: "https://example.com/b", Fragment: "usage", Referrer: "https://example.com/", Reason: FragmentAnchorMissing},
+		{URL: "https://example.com/gone", Fragment: "top", Referrer: "https://example.com/c", Reason: FragmentTargetMissing},
+	}}
+	var buf bytes.Buffer
+	if err := ReportBrokenFragmentsCSV(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Report is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"source_page", "fragment", "target_page", "reason"},
+		{"https://example.com/", "usage", "https://example.com/b", "anchor_missing"},
+		{"https://example.com/c", "intro", "https://example.com/a", "anchor_missing"},
+		{"https://example.com/c", "top", "https://example.com/gone", "target_missing"},
+	}
+	if !slices.EqualFunc(records, want, slices.Equal[[]string]) {
+		t.Errorf("Expected records %q, got %q", want, records)
+	}
+}
+
+func TestWriteReportFile_Gzip(t *testing.T) {
+	result := Result{DeadLinks: []DeadLink{{URL: "https://example.com/missing", StatusCode: http.StatusNotFound}}}
+	var want bytes.Buffer
+	if err := ReportJSON(&want, result); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		compress bool
+		gzipped  bool
+	}{
+		{"report.json", false, false},
+		{"report.json.gz", false, true},
+		{"report.json", true, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		result.CompressReport = tt.compress
+		if err := WriteReportFile(path, result, ReportJSON); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if tt.gzipped {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("%s, compress=%v: expected gzip output: %v", tt.name, tt.compress, err)
+			}
+			r = zr
+		}
+		got, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%s, compress=%v: expected report %q, got %q", tt.name, tt.compress, want.String(), got)
+		}
+	}
+}
+
+func TestReportGitHubActions(t *testing.T) {
+	result := Result{DeadLinks: []DeadLink{
+		{URL: "https://example.com/missing", Referrer: "https://example.com/a,b", AnchorText: "Missing", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus},
+		{URL: "https://down.example/", Kind: KindNetworkError, Error: "dial tcp: connection refused\nretry later"},
+	}}
+	var buf bytes.Buffer
+	if err := ReportGitHubActions(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := `::error title=Dead link on https%3A//example.com/a%2Cb::https://example.com/missing: status 404 Not Found (anchor "Missing")
+::error title=Dead link::https://down.example/: dial tcp: connection refused%0Aretry later
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Expected annotations:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestReportMarkdown(t *testing.T) {
+	result := Result{
+		DeadLinks: []DeadLink{
+			{URL: "https://down.example/", Referrer: "https://example.com/", Kind: KindNetworkError, Error: "connection refused"},
+			{URL: "https://example.com/a|b", Referrer: "https://example.com/", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus},
+			{URL: "https://example.com/error", Referrer: "https://example.com/a", StatusCode: http.StatusInternalServerError, Kind: KindHTTPStatus},
+			{URL: "https://example.com/gone", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus},
+		},
+		Pages:    make([]Page, 3),
+		Duration: 1500 * time.Millisecond,
+	}
+	var buf bytes.Buffer
+	if err := ReportMarkdown(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := `# Dead links
+
+Crawled 3 pages in 1.5s and found 4 dead links.
+
+## 404 Not Found (2)
+
+| URL | Status | Referrer |
+| --- | --- | --- |
+| https://example.com/a\|b | status 404 Not Found | https://example.com/ |
+| https://example.com/gone | status 404 Not Found |  |
+
+## 500 Internal Server Error (1)
+
+| URL | Status | Referrer |
+| --- | --- | --- |
+| https://example.com/error | status 500 Internal Server Error | https://example.com/a |
+
+## No response (1)
+
+| URL | Status | Referrer |
+| --- | --- | --- |
+| https://down.example/ | connection refused | https://example.com/ |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Expected report:\n%s\ngot:\n%s", want, got)
+	}
+
+	buf.Reset()
+	if err := ReportMarkdown(&buf, Result{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No dead links found 🎉") {
+		t.Errorf("Expected the empty report to say so, got:\n%s", buf.String())
+	}
+}
+
+func TestReportAtom(t *testing.T) {
+	found := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	result := Result{
+		Seed: "https://example.com",
+		DeadLinks: []DeadLink{
+			{URL: "https://example.com/missing", Referrer: "https://example.com/a", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus, FoundAt: found},
+			{URL: "https://down.example/", Kind: KindNetworkError, Error: "connection refused", FoundAt: found.Add(time.Minute)},
+		},
+	}
+	var buf bytes.Buffer
+	if err := ReportAtom(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Title   string   `xml:"title"`
+		Updated string   `xml:"updated"`
+		Author  string   `xml:"author>name"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Title   string `xml:"title"`
+			Updated string `xml:"updated"`
+			Link    struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+			Summary string `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("Expected a valid Atom feed, got: %v\n%s", err, buf.String())
+	}
+	if !strings.HasPrefix(feed.ID, "urn:uuid:") || feed.ID != atomID("https://example.com") {
+		t.Errorf("Expected a feed ID derived from the seed, got: %q", feed.ID)
+	}
+	if feed.Title == "" || feed.Author == "" || feed.Updated != "2024-05-01T12:01:00Z" {
+		t.Errorf("Expected a title, an author and the latest discovery as update time, got: %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got: %+v", feed.Entries)
+	}
+	entry := feed.Entries[0]
+	if entry.Link.Href != "https://example.com/missing" || entry.Updated != "2024-05-01T12:00:00Z" ||
+		entry.Summary != "status 404 Not Found, linked from https://example.com/a" {
+		t.Errorf("Expected an entry for the missing page, got: %+v", entry)
+	}
+	if entry.ID == feed.Entries[1].ID || entry.ID == feed.ID {
+		t.Errorf("Expected distinct IDs, got: %q, %q and %q", feed.ID, entry.ID, feed.Entries[1].ID)
+	}
+
+	// IDs are stable across crawls.
+	var again bytes.Buffer
+	if err := ReportAtom(&again, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if again.String() != buf.String() {
+		t.Errorf("Expected the same feed for the same result, got:\n%s\nand:\n%s", buf.String(), again.String())
+	}
+
+	// A crawl without dead links gives a fixed update time.
+	buf.Reset()
+	if err := ReportAtom(&buf, Result{Seed: "https://example.com"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("Expected a valid Atom feed, got: %v\n%s", err, buf.String())
+	}
+	if feed.Updated != "0001-01-01T00:00:00Z" {
+		t.Errorf("Expected the zero time as update time without dead links, got: %q", feed.Updated)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a crawl.
+type Result struct {
+	// Label is Config.Label.
+	Label string `json:"label,omitempty"`
+	// CompressReport is Config.CompressReport.
+	CompressReport bool `json:"-"`
+	// Seed is the URL the crawl started from, without its credentials.
+	Seed      string     `json:"seed,omitempty"`
+	DeadLinks []DeadLink `json:"dead_links"`
+	// DeadLinksTruncated is set if the crawl was aborted because more dead
+	// links than Config.MaxDeadLinks were found.
+	DeadLinksTruncated bool `json:"dead_links_truncated,omitempty"`
+	// Pages lists the same-domain HTML pages that were fetched successfully.
+	Pages []Page `json:"pages"`
+	// OrphanPages lists the sitemap URLs that no link from the seed led to.
+	OrphanPages []string `json:"orphan_pages,omitempty"`
+	// Traps lists the path templates that went over Config.MaxTemplateHits
+	// and were no longer crawled.
+	Traps []string `json:"traps,omitempty"`
+	// Skipped lists the URLs left unchecked because their host used up
+	// Config.MaxDurationPerHost, or because they are longer than
+	// Config.MaxURLLength.
+	Skipped []string `json:"skipped,omitempty"`
+	// DeadEndPages lists the HTML pages of the site that link to no other
+	// web page. Pages that were not parsed, such as images, are not listed.
+	DeadEndPages []string `json:"dead_end_pages,omitempty"`
+	// HreflangIssues lists the hreflang alternates that do not link back,
+	// if Config.CheckHreflangReciprocity is set.
+	HreflangIssues []HreflangIssue `json:"hreflang_issues,omitempty"`
+	// ExternalRedirects lists the links of the site that redirect off it,
+	// which may be open redirects.
+	ExternalRedirects []ExternalRedirect `json:"external_redirects,omitempty"`
+	// LinkCounts maps the HTML pages of the site to the number of links
+	// they contain, if Config.CountLinks is set.
+	LinkCounts map[string]LinkCounts `json:"link_counts,omitempty"`
+	// BrokenFragments lists the links to anchors missing from their page,
+	// if Config.CheckFragments is set.
+	BrokenFragments []BrokenFragment `json:"broken_fragments,omitempty"`
+	// SelfLinks lists the pages that link to themselves, which may be a
+	// template bug.
+	SelfLinks []string `json:"self_links,omitempty"`
+	// LinkCycles lists the groups of at least Config.MinCycleSize pages
+	// that all link to one another, directly or not.
+	LinkCycles [][]string `json:"link_cycles,omitempty"`
+	// Redirects lists the redirects met, if Config.FollowRedirects is
+	// unset.
+	Redirects []Redirect `json:"redirects,omitempty"`
+	// ReachabilityBySeed maps the HTML pages of the site to the seeds they
+	// can be reached from by following links, in the order of the URL given
+	// to Run then Config.Seeds, if Config.Seeds is set.
+	ReachabilityBySeed map[string][]string `json:"reachability_by_seed,omitempty"`
+	// DegradedPages lists the HTML pages of the site with at least
+	// Config.DegradedThreshold of their assets dead, which likely render
+	// broken although they load.
+	DegradedPages []DegradedPage `json:"degraded_pages,omitempty"`
+	// EmptyPages lists the HTML pages of the site with an empty or short
+	// body, if Config.FlagEmptyPages is set.
+	EmptyPages []string `json:"empty_pages,omitempty"`
+	// DuplicateIDPages maps the HTML pages of the site with id attributes
+	// used more than once, which breaks anchor navigation, to those ids, if
+	// Config.ReportDuplicateIDs is set.
+	DuplicateIDPages map[string][]string `json:"duplicate_id_pages,omitempty"`
+	// DiscoveryTree maps each URL queued to the page it was first found
+	// on, or "" for the seeds and sitemap URLs. See PrintTree.
+	DiscoveryTree map[string]string `json:"discovery_tree,omitempty"`
+	// SocialMetaIssues lists the dead URLs of Open Graph and Twitter card
+	// metadata, which break social sharing previews, if
+	// Config.CheckSocialMeta is set. They are among DeadLinks too.
+	SocialMetaIssues []SocialMetaIssue `json:"social_meta_issues,omitempty"`
+	// Duration is how long the crawl took.
+	Duration time.Duration `json:"duration,omitempty"`
+	// QueueWait is how long URLs waited in the frontier before a worker
+	// took them, and ServiceTime how long checking them took. A long queue
+	// wait means more workers would help; a long service time that the
+	// crawl is bound by the servers.
+	QueueWait   Latency `json:"queue_wait"`
+	ServiceTime Latency `json:"service_time"`
+	// Throughput averages the requests sent, the pages fetched and the
+	// bytes read over Duration.
+	Throughput Throughput `json:"throughput"`
+}
+
+// Latency summarizes a duration measured for each checked URL.
+type Latency struct {
+	Mean time.Duration `json:"mean"`
+	Max  time.Duration `json:"max"`
+}
+
+// Save writes r to w as JSON, for LoadResult to read back.
+func (r Result) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// LoadResult reads a Result written by Result.Save.
+func LoadResult(r io.Reader) (Result, error) {
+	var result Result
+	err := json.NewDecoder(r).Decode(&result)
+	return result, err
+}
+
+// DeadLink describes a link that could not be reached.
+type DeadLink struct {
+	URL string `json:"url"`
+	// Referrer is the page the link was found on. It is empty for the seed.
+	Referrer string `json:"referrer,omitempty"`
+	// AnchorText is the visible text of the anchor that linked here.
+	AnchorText string `json:"anchor_text,omitempty"`
+	// Rel tells what kind of resource the link is, e.g. "preload" for a
+	// resource hint or "srcset" for an image candidate. It is empty for
+	// anchors.
+	Rel string `json:"rel,omitempty"`
+	// StatusCode is the response status, or 0 if no response was received.
+	StatusCode int `json:"status_code,omitempty"`
+	// Headers are the response headers, if Config.CaptureHeaders is set.
+	Headers http.Header `json:"headers,omitempty"`
+	// Body is the start of the response body, if Config.CaptureDeadBody is
+	// set.
+	Body string `json:"body,omitempty"`
+	// Kind tells why the link is dead.
+	Kind ErrorKind `json:"kind"`
+	// Error is the request error, when no response was received.
+	Error string `json:"error,omitempty"`
+	// Reason details a KindTLSError, e.g. "expired" or "hostname mismatch".
+	Reason string `json:"reason,omitempty"`
+	// FoundAt is when the link was found dead.
+	FoundAt time.Time `json:"found_at"`
+}
+
+// sortDeadLinks sorts deadLinks in order.
+func sortDeadLinks(deadLinks []DeadLink, order SortOrder) {
+	var compare func(a, b DeadLink) int
+	switch order {
+	case SortByURL:
+		compare = func(a, b DeadLink) int {
+			return cmp.Or(strings.Compare(a.URL, b.URL), strings.Compare(a.Referrer, b.Referrer))
+		}
+	case SortByStatus:
+		compare = func(a, b DeadLink) int {
+			return cmp.Or(cmp.Compare(a.StatusCode, b.StatusCode), strings.Compare(a.URL, b.URL), strings.Compare(a.Referrer, b.Referrer))
+		}
+	case SortByReferrer:
+		compare = func(a, b DeadLink) int {
+			return cmp.Or(strings.Compare(a.Referrer, b.Referrer), strings.Compare(a.URL, b.URL))
+		}
+	default:
+		return
+	}
+	slices.SortStableFunc(deadLinks, compare)
+}
+
+// ErrorKind classifies why a link is dead.
+type ErrorKind string
+
+const (
+	// KindHTTPStatus means the server answered with a dead status code.
+	KindHTTPStatus ErrorKind = "http_status"
+	// KindNetworkError means no response was received.
+	KindNetworkError ErrorKind = "network_error"
+	// KindTLSError means the TLS handshake failed, for instance because of
+	// an invalid certificate.
+	KindTLSError ErrorKind = "tls_error"
+	// KindDeadResponse means Config.IsDeadResponse judged the response
+	// dead, whatever its status.
+	KindDeadResponse ErrorKind = "dead_response"
+)
+
+// Redirect describes a link answered with a redirect that was not
+// followed.
+type Redirect struct {
+	URL string `json:"url"`
+	// Referrer is the page the link was found on. It is empty for the seed.
+	Referrer   string `json:"referrer,omitempty"`
+	StatusCode int    `json:"status_code"`
+	// Location is the redirect target, resolved against URL. It is empty if
+	// the Location header is missing or invalid.
+	Location string `json:"location,omitempty"`
+}
+
+// ExternalRedirect describes a link of the site whose redirects end on
+// another site.
+type ExternalRedirect struct {
+	URL string `json:"url"`
+	// Referrer is the page the link was found on. It is empty for the seed.
+	Referrer string `json:"referrer,omitempty"`
+	// FinalURL is where the redirects ended.
+	FinalURL string `json:"final_url"`
+	// OriginHost and FinalHost are the hosts of URL and FinalURL.
+	OriginHost string `json:"origin_host"`
+	FinalHost  string `json:"final_host"`
+}
+
+// LinkCounts counts the links of a page by kind.
+type LinkCounts struct {
+	// Internal and External count the links to pages in and out of the
+	// site.
+	Internal int `json:"internal"`
+	External int `json:"external"`
+	// Assets counts the links to resources, such as images.
+	Assets int `json:"assets"`
+}
+
+// Page describes a live page of the crawled site.
+type Page struct {
+	URL string `json:"url"`
+	// LastModified is taken from the Last-Modified header. It is zero if the
+	// header was missing.
+	LastModified time.Time `json:"last_modified"`
+	// ETag is taken from the ETag header.
+	ETag string `json:"etag,omitempty"`
+	// Links lists the URLs linked from the page, for Config.Previous and
+	// the analysis of the site's link graph.
+	Links []string `json:"links,omitempty"`
+}
+
+// collector accumulates the parts of a Result reported by workers. Dead
+// links are collected separately, through their own channel.
+type collector struct {
+	mu     sync.Mutex
+	result Result
+	// alternates maps pages to their hreflang alternates.
+	alternates map[string][]string
+	// anchors maps the linkKey of pages to their anchors, and
+	// fragmentLinks lists the links to anchors, for Config.CheckFragments.
+	anchors       map[string][]string
+	fragmentLinks []fragmentLink
+	// assets maps pages to their assets, for Config.DegradedThreshold.
+	assets map[string][]string
+}
+
+func newCollector() *collector {
+	return &collector{
+		result:     Result{Pages: make([]Page, 0)},
+		alternates: make(map[string][]string),
+		anchors:    make(map[string][]string),
+		assets:     make(map[string][]string),
+	}
+}
+
+func (c *collector) addPage(page Page) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Pages = append(c.result.Pages, page)
+}
+
+func (c *collector) addOrphan(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.OrphanPages = append(c.result.OrphanPages, u)
+}
+
+func (c *collector) addTrap(template string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Traps = append(c.result.Traps, template)
+}
+
+func (c *collector) addSkipped(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Skipped = append(c.result.Skipped, u)
+}
+
+func (c *collector) addDeadEnd(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.DeadEndPages = append(c.result.DeadEndPages, u)
+}
+
+func (c *collector) addAlternates(page string, alternates []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.alternates[page] = alternates
+}
+
+func (c *collector) addExternalRedirect(redirect ExternalRedirect) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.ExternalRedirects = append(c.result.ExternalRedirects, redirect)
+}
+
+func (c *collector) addLinkCounts(page string, counts LinkCounts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result.LinkCounts == nil {
+		c.result.LinkCounts = make(map[string]LinkCounts)
+	}
+	c.result.LinkCounts[page] = counts
+}
+
+func (c *collector) addAnchors(page string, ids []string, links []fragmentLink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.anchors[page] = ids
+	c.fragmentLinks = append(c.fragmentLinks, links...)
+}
+
+func (c *collector) addRedirect(redirect Redirect) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.Redirects = append(c.result.Redirects, redirect)
+}
+
+func (c *collector) addEmptyPage(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.EmptyPages = append(c.result.EmptyPages, u)
+}
+
+func (c *collector) addDuplicateIDs(page string, ids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result.DuplicateIDPages == nil {
+		c.result.DuplicateIDPages = make(map[string][]string)
+	}
+	c.result.DuplicateIDPages[page] = ids
+}
+
+func (c *collector) addDiscovered(j *job) {
+	var parent string
+	if j.referrer != nil {
+		parent = j.referrer.String()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result.DiscoveryTree == nil {
+		c.result.DiscoveryTree = make(map[string]string)
+	}
+	c.result.DiscoveryTree[j.url.String()] = parent
+}
+
+func (c *collector) addAssets(page string, assets []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assets[page] = assets
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResult_SaveLoad(t *testing.T) {
+	result := Result{
+		DeadLinks: []DeadLink{
+			{
+				URL:        "https://example.com/missing",
+				Referrer:   "https://example.com/",
+				AnchorText: "Missing",
+				StatusCode: http.StatusNotFound,
+				Headers:    http.Header{"Server": {"nginx"}},
+				Kind:       KindHTTPStatus,
+				Body:       "Not Found",
+			},
+			{URL: "https://expired.example/", Kind: KindTLSError, Error: "x509: certificate has expired", Reason: "expired certificate"},
+		},
+		Pages: []Page{
+			{
+				URL:          "https://example.com/",
+				LastModified: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+				ETag:         `"v1"`,
+				Links:        []string{"https://example.com/missing"},
+			},
+		},
+		OrphanPages: []string{"https://example.com/orphan"},
+		Traps:       []string{"example.com/calendar/{n}"},
+	}
+
+	var buf bytes.Buffer
+	if err := result.Save(&buf); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	loaded, err := LoadResult(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, result) {
+		t.Errorf("Expected loaded result to equal the saved one:\n got: %+v\nwant: %+v", loaded, result)
+	}
+
+	if _, err := LoadResult(bytes.NewBufferString("not json")); err == nil {
+		t.Errorf("Expected an error for an invalid result")
+	}
+}
+
+func TestSortDeadLinks(t *testing.T) {
+	deadLinks := []DeadLink{
+		{URL: "https://example.com/b", Referrer: "https://example.com/x", StatusCode: http.StatusNotFound},
+		{URL: "https://example.com/a", Referrer: "https://example.com/y", StatusCode: http.StatusInternalServerError},
+		{URL: "https://down.example/", Referrer: "https://example.com/y", Kind: KindNetworkError},
+		{URL: "https://example.com/a", Referrer: "https://example.com/x", StatusCode: http.StatusInternalServerError},
+	}
+	urls := func(deadLinks []DeadLink) []string {
+		var urls []string
+		for _, deadLink := range deadLinks {
+			urls = append(urls, deadLink.URL+" from "+deadLink.Referrer)
+		}
+		return urls
+	}
+	tests := []struct {
+		order SortOrder
+		want  []int
+	}{
+		{SortNone, []int{0, 1, 2, 3}},
+		{SortByURL, []int{2, 3, 1, 0}},
+		{SortByStatus, []int{2, 0, 3, 1}},
+		{SortByReferrer, []int{3, 0, 2, 1}},
+	}
+	for _, tt := range tests {
+		got := slices.Clone(deadLinks)
+		sortDeadLinks(got, tt.order)
+		var want []DeadLink
+		for _, i := range tt.want {
+			want = append(want, deadLinks[i])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Order %d: expected %v, got %v", tt.order, urls(want), urls(got))
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errNewRequest means a request could not even be built, as opposed to
+// having failed.
+var errNewRequest = errors.New("could not create request")
+
+// retryableStatus reports whether a response with code may succeed when
+// retried.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isIdempotent reports whether requests with method can be retried without
+// risking duplicate side effects. It matches the methods net/http itself
+// is willing to replay.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// do sends a request for the scraped job, retrying transient failures up to
+// Config.MaxRetries times with exponential backoff. Non-idempotent requests
+// are only retried with Config.RetryNonIdempotent. Each attempt gets its
+// own timeout, and the returned cancel func, which is never nil, must be
+// called once the response body has been read.
+func (data *ScrapeData) do(ctx context.Context, method string) (*http.Response, context.CancelFunc, error) {
+	retries := data.cfg.MaxRetries
+	if !isIdempotent(method) && !data.cfg.RetryNonIdempotent {
+		retries = 0
+	}
+	return data.send(ctx, method, retries)
+}
+
+// send is do, with retries as the number of retries.
+func (data *ScrapeData) send(ctx context.Context, method string, retries int) (*http.Response, context.CancelFunc, error) {
+	backoff := data.cfg.RetryBackoff
+	begun := time.Now()
+	for attempt := 0; ; attempt++ {
+		release, err := data.acquireInFlight(ctx)
+		if err != nil {
+			return nil, func() {}, err
+		}
+		attemptCtx, cancelAttempt := data.attemptContext(ctx, begun)
+		cancel := func() {
+			cancelAttempt()
+			release()
+		}
+		req, err := data.newRequest(data.stats.traced(attemptCtx), method)
+		if err != nil {
+			return nil, cancel, fmt.Errorf("%w: %w", errNewRequest, err)
+		}
+
+		data.log().Info(fmt.Sprintf("Sending request to %s", data.job.url.String()))
+		start := time.Now()
+		data.stats.request(start)
+		resp, err := data.client.Do(req)
+		data.limiter.observe(start, resp, err)
+		data.pacer.observe(data.job.url.Host, start)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && data.tokens != nil && req.Header.Get("Authorization") != "" {
+			resp, err = data.reauthorize(req, resp)
+		}
+		if err == nil {
+			resp.Body = data.stats.countBody(resp.Body)
+		}
+		transient := (err != nil && ctx.Err() == nil) || (err == nil && retryableStatus(resp.StatusCode))
+		if !transient || attempt >= retries {
+			return resp, cancel, err
+		}
+		if data.cfg.MaxRetryDuration > 0 && time.Since(begun)+backoff >= data.cfg.MaxRetryDuration {
+			data.log().Info(fmt.Sprintf("Giving up on %s, out of time to retry", data.job.url))
+			return resp, cancel, err
+		}
+
+		if resp != nil {
+			closeBody(resp.Body)
+		}
+		cancel()
+		data.log().Info(fmt.Sprintf("Retrying %s in %s (retry %d of %d)", data.job.url, backoff, attempt+1, retries))
+		if err := sleep(ctx, backoff); err != nil {
+			return nil, func() {}, err
+		}
+		backoff *= 2
+	}
+}
+
+// attemptContext returns the context of a request attempt: the one
+// Config.RequestContext derives from ctx, or ctx with the job's timeout.
+// Every attempt is also cut short by what is left of Config.MaxRetryDuration.
+func (data *ScrapeData) attemptContext(ctx context.Context, begun time.Time) (context.Context, context.CancelFunc) {
+	budgeted := data.cfg.MaxRetryDuration > 0
+	if data.cfg.RequestContext != nil {
+		ctx, cancelRequest := data.cfg.RequestContext(ctx, data.job.url)
+		if !budgeted {
+			return ctx, cancelRequest
+		}
+		ctx, cancelBudget := context.WithTimeout(ctx, data.cfg.MaxRetryDuration-time.Since(begun))
+		return ctx, func() {
+			cancelBudget()
+			cancelRequest()
+		}
+	}
+	timeout := data.cfg.timeoutFor(data.job.url)
+	if budgeted {
+		timeout = min(timeout, data.cfg.MaxRetryDuration-time.Since(begun))
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// maxDrainBytes bounds how much of an unread body closeBody discards. A
+// longer body is cheaper to abandon along with its connection.
+const maxDrainBytes = 256 << 10
+
+// closeBody discards what is left of a response body and closes it, so that
+// its connection can be reused by the next request.
+func closeBody(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxDrainBytes)
+	body.Close()
+}
+
+// acquireInFlight waits for a slot among the requests allowed to the job's
+// host, then among Config.MaxInFlight requests, or those allowed by
+// Config.AdaptiveConcurrency. The returned release func frees both, and
+// must be called exactly once.
+func (data *ScrapeData) acquireInFlight(ctx context.Context) (release func(), err error) {
+	// The host slot comes first, so that requests waiting for a busy host
+	// do not hold slots other hosts could use.
+	releaseHost, err := data.hostSlots.acquire(ctx, data.job.url.Host, data.hostConcurrency(ctx))
+	if err != nil {
+		return nil, err
+	}
+	releaseGlobal, err := data.acquireGlobal(ctx)
+	if err != nil {
+		releaseHost()
+		return nil, err
+	}
+	return func() {
+		releaseGlobal()
+		releaseHost()
+	}, nil
+}
+
+// hostConcurrency returns the number of requests allowed at once to the
+// job's host, or 0 if it is unbounded.
+func (data *ScrapeData) hostConcurrency(ctx context.Context) int {
+	if data.hostSlots == nil {
+		return 0
+	}
+	var rules *robotsRules
+	if data.robots != nil {
+		rules = data.robots.rules(ctx, data.job.url)
+	}
+	return data.cfg.hostConcurrency(data.job.url, rules)
+}
+
+func (data *ScrapeData) acquireGlobal(ctx context.Context) (release func(), err error) {
+	if data.limiter != nil {
+		return data.limiter.acquire(ctx)
+	}
+	if data.inFlight == nil {
+		return func() {}, nil
+	}
+	select {
+	case data.inFlight <- struct{}{}:
+		return func() { <-data.inFlight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newRequest builds a request for the scraped job.
+func (data *ScrapeData) newRequest(ctx context.Context, method string) (*http.Request, error) {
+	target := data.job.url
+	if data.cfg.RewriteURL != nil {
+		clone := *target
+		target = data.cfg.RewriteURL(&clone)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if data.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", data.cfg.UserAgent)
+	}
+	// Credentials go in a header, so that request errors never show them.
+	if data.job.userinfo != nil {
+		password, _ := data.job.userinfo.Password()
+		req.SetBasicAuth(data.job.userinfo.Username(), password)
+	}
+	// The token is only for the crawled site, not for the sites it links
+	// to.
+	if data.tokens != nil && data.inScope(data.job.url) {
+		token, err := data.tokens.get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	data.previous.setConditional(req, data.job.url)
+	return req, nil
+}
+
+// reauthorize sends req again with a refreshed bearer token, after resp
+// rejected it. If no token can be had, resp is returned as is.
+func (data *ScrapeData) reauthorize(req *http.Request, resp *http.Response) (*http.Response, error) {
+	rejected := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	token, err := data.tokens.refresh(req.Context(), rejected)
+	if err != nil {
+		data.log().Warn(fmt.Sprintf("Could not refresh token for %s: %s", data.job.url, err.Error()))
+		return resp, nil
+	}
+	closeBody(resp.Body)
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", "Bearer "+token)
+	data.log().Info(fmt.Sprintf("Sending request to %s with a refreshed token", data.job.url))
+	data.stats.request(time.Now())
+	return data.client.Do(retry)
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartScraper_Retries(t *testing.T) {
+	var flakyHits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/flaky">flaky</a></body></html>`)
+		case "/flaky":
+			// Fails twice before recovering.
+			if flakyHits.Add(1) <= 2 {
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, `<html><body>Recovered</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Millisecond
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected the flaky link to recover, got: %v", deadLinks)
+	}
+	if n := flakyHits.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestDo_MaxRetryDuration(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// Never answers in time.
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/slow")
+	cfg := DefaultConfig()
+	cfg.Timeout = 50 * time.Millisecond
+	cfg.MaxRetries = 10
+	cfg.RetryBackoff = time.Millisecond
+	cfg.MaxRetryDuration = 150 * time.Millisecond
+	data := &ScrapeData{
+		WorkerData: &WorkerData{cfg: &cfg, client: ts.Client()},
+		job:        &job{url: u},
+	}
+
+	start := time.Now()
+	_, cancel, err := data.do(context.Background(), http.MethodGet)
+	defer cancel()
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("Expected the slow request to fail")
+	}
+	if elapsed > cfg.MaxRetryDuration+50*time.Millisecond {
+		t.Errorf("Expected retries to stop within %s, took %s", cfg.MaxRetryDuration, elapsed)
+	}
+	if n := hits.Load(); n < 2 || n > 4 {
+		t.Errorf("Expected a few attempts within the budget, got %d", n)
+	}
+}
+
+func TestDo_MaxRetryDurationFirstAttempt(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/slow")
+	cfg := DefaultConfig()
+	cfg.Timeout = time.Second
+	cfg.MaxRetries = 0
+	cfg.MaxRetryDuration = 50 * time.Millisecond
+	data := &ScrapeData{
+		WorkerData: &WorkerData{cfg: &cfg, client: ts.Client()},
+		job:        &job{url: u},
+	}
+
+	start := time.Now()
+	_, cancel, err := data.do(context.Background(), http.MethodGet)
+	defer cancel()
+	if err == nil {
+		t.Fatal("Expected the slow request to fail")
+	}
+	if elapsed := time.Since(start); elapsed > cfg.MaxRetryDuration+50*time.Millisecond {
+		t.Errorf("Expected the first attempt to stop within %s, took %s", cfg.MaxRetryDuration, elapsed)
+	}
+}
+
+func TestDo_NonIdempotentNotRetried(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/form")
+	post := func(retryNonIdempotent bool) int32 {
+		hits.Store(0)
+		cfg := DefaultConfig()
+		cfg.MaxRetries = 2
+		cfg.RetryBackoff = time.Millisecond
+		cfg.RetryNonIdempotent = retryNonIdempotent
+		data := &ScrapeData{
+			WorkerData: &WorkerData{cfg: &cfg, client: ts.Client()},
+			job:        &job{url: u},
+		}
+
+		resp, cancel, err := data.do(context.Background(), http.MethodPost)
+		defer cancel()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		resp.Body.Close()
+		return hits.Load()
+	}
+
+	if n := post(false); n != 1 {
+		t.Errorf("Expected a POST to be sent once by default, got %d attempts", n)
+	}
+	if n := post(true); n != 3 {
+		t.Errorf("Expected a POST to be retried when allowed, got %d attempts", n)
+	}
+}
+
+func TestStartScraper_TokenProvider(t *testing.T) {
+	var leaked atomic.Bool
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked.Store(true)
+		}
+	}))
+	defer external.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/a">a</a><a href="/b">b</a><a href="%s">external</a></body></html>`, external.URL)
+		default:
+			fmt.Fprint(w, `<html><body>ok</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var calls atomic.Int32
+	cfg := DefaultConfig()
+	cfg.TokenProvider = func(ctx context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			return "stale", nil
+		}
+		return "fresh", nil
+	}
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected the refreshed token to be accepted, got: %v", deadLinks)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected the token to be refreshed once, got %d calls", got)
+	}
+	if leaked.Load() {
+		t.Error("Expected the token not to be sent to other sites")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRules holds the robots.txt directives of one host that apply to
+// our user agent.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+	// crawlDelay is the requested spacing between requests, or zero.
+	crawlDelay time.Duration
+}
+
+// robotsGroup is a set of rules and the user agents they apply to.
+type robotsGroup struct {
+	agents []string
+	rules  robotsRules
+}
+
+// parseRobots parses a robots.txt file and returns the rules of the group
+// that best matches userAgent, falling back to the "*" group.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	groups := make([]*robotsGroup, 0)
+	var current *robotsGroup
+	// inAgents is true while reading consecutive User-agent lines.
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		}
+		inAgents = false
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "allow":
+			if value != "" {
+				current.rules.allow = append(current.rules.allow, value)
+			}
+		case "disallow":
+			if value != "" {
+				current.rules.disallow = append(current.rules.disallow, value)
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	// Match on the product token, e.g. "scraper" for "scraper/1.0".
+	token, _, _ := strings.Cut(strings.ToLower(userAgent), "/")
+	var fallback *robotsRules
+	for _, group := range groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				if fallback == nil {
+					fallback = &group.rules
+				}
+			} else if token != "" && strings.Contains(token, agent) {
+				return &group.rules
+			}
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return &robotsRules{}
+}
+
+// allowed reports whether path may be crawled. The longest matching rule
+// wins, and Allow wins ties.
+func (r *robotsRules) allowed(path string) bool {
+	longest := func(prefixes []string) int {
+		length := -1
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) && len(prefix) > length {
+				length = len(prefix)
+			}
+		}
+		return length
+	}
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// robotsCache fetches and caches the robots.txt rules of each host.
+type robotsCache struct {
+	client    *http.Client
+	userAgent string
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	mu    sync.Mutex
+	rules *robotsRules
+}
+
+func newRobotsCache(client *http.Client, cfg *Config, logger *slog.Logger) *robotsCache {
+	return &robotsCache{
+		client:    client,
+		userAgent: cfg.UserAgent,
+		timeout:   cfg.Timeout,
+		logger:    logger,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// rules returns the rules for u's host, fetching them on first use. Hosts
+// whose robots.txt cannot be fetched allow everything. A fetch cut short by
+// ctx says nothing about the host, so it is not cached.
+func (c *robotsCache) rules(ctx context.Context, u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &robotsEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.rules != nil {
+		return entry.rules
+	}
+	rules, err := c.fetch(ctx, key+"/robots.txt")
+	if err != nil {
+		c.logger.Debug(fmt.Sprintf("No robots.txt for %s: %s", key, err.Error()))
+		rules = &robotsRules{}
+		if ctx.Err() != nil {
+			return rules
+		}
+	}
+	entry.rules = rules
+	return rules
+}
+
+func (c *robotsCache) fetch(ctx context.Context, robotsURL string) (*robotsRules, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return parseRobots(resp.Body, c.userAgent), nil
+}
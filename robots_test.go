@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := `
+# Everyone else
+User-agent: *
+Disallow: /
+
+User-agent: other-bot
+User-agent: scraper
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+`
+	rules := parseRobots(strings.NewReader(robots), "scraper/1.0")
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("Expected crawl delay 2s, got %s", rules.crawlDelay)
+	}
+	tests := map[string]bool{
+		"/":                    true,
+		"/private":             false,
+		"/private/secret":      false,
+		"/private/public/page": true,
+	}
+	for path, want := range tests {
+		if got := rules.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// Unknown agents fall back to the "*" group.
+	if parseRobots(strings.NewReader(robots), "unknown").allowed("/page") {
+		t.Errorf("Expected the fallback group to disallow everything")
+	}
+}
+
+func TestStartScraper_RobotsCrawlDelay(t *testing.T) {
+	const crawlDelay = 100 * time.Millisecond
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	times := make([]time.Time, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: scraper\nCrawl-delay: %g\nDisallow: /private\n", crawlDelay.Seconds())
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		times = append(times, time.Now())
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/private">private</a></body></html>`)
+			return
+		}
+		fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.RespectRobots = true
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if slices.Contains(requests, "/private") {
+		t.Errorf("Expected /private to be skipped, got requests: %v", requests)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got: %v", requests)
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+	for i := 1; i < len(times); i++ {
+		// Allow for timer granularity.
+		if gap := times[i].Sub(times[i-1]); gap < crawlDelay-10*time.Millisecond {
+			t.Errorf("Expected requests at least %s apart, got %s", crawlDelay, gap)
+		}
+	}
+}
+
+func TestRobotsCache_Cancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cache := newRobotsCache(ts.Client(), &cfg, slog.Default())
+	u, _ := url.Parse(ts.URL + "/private")
+
+	// A fetch given up on by its caller does not decide for the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !cache.rules(ctx, u).allowed(u.Path) {
+		t.Errorf("Expected a cancelled fetch to allow everything")
+	}
+	if cache.rules(context.Background(), u).allowed(u.Path) {
+		t.Errorf("Expected robots.txt to be fetched again and disallow %s", u.Path)
+	}
+}
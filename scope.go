@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/url"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope decides which hosts count as part of the crawled site.
+type Scope int
+
+const (
+	// ScopeExactHost only crawls URLs whose host, including the port,
+	// matches the seed's.
+	ScopeExactHost Scope = iota
+	// ScopeRegistrableDomain crawls every host sharing the seed's
+	// registrable domain (eTLD+1), so www.example.com and example.com are
+	// the same site.
+	ScopeRegistrableDomain
+	// ScopeAnyHost crawls every host. Use it together with MaxPages.
+	ScopeAnyHost
+)
+
+// inScope reports whether u belongs to the same site as base.
+func (s Scope) inScope(u *url.URL, base *url.URL) bool {
+	switch s {
+	case ScopeRegistrableDomain:
+		return registrableDomain(u) == registrableDomain(base)
+	case ScopeAnyHost:
+		return true
+	default:
+		return isSameDomain(u, base)
+	}
+}
+
+// registrableDomain returns the eTLD+1 of u's host. Hosts without one, such
+// as IP addresses or localhost, are returned unchanged.
+func registrableDomain(u *url.URL) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(u.Hostname())
+	if err != nil {
+		return u.Hostname()
+	}
+	return domain
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScope_InScope(t *testing.T) {
+	tests := []struct {
+		scope Scope
+		base  string
+		link  string
+		want  bool
+	}{
+		{ScopeExactHost, "https://example.com/", "https://example.com/page", true},
+		{ScopeExactHost, "https://example.com/", "https://www.example.com/page", false},
+		{ScopeRegistrableDomain, "https://example.com/", "https://www.example.com/page", true},
+		{ScopeRegistrableDomain, "https://www.example.com/", "https://example.com/page", true},
+		{ScopeRegistrableDomain, "https://example.com/", "https://example.org/page", false},
+		// Sites under a multi-label public suffix are still told apart.
+		{ScopeRegistrableDomain, "https://www.example.co.uk/", "https://other.co.uk/page", false},
+		{ScopeAnyHost, "https://example.com/", "https://example.org/page", true},
+	}
+
+	for _, tt := range tests {
+		base, err := url.Parse(tt.base)
+		if err != nil {
+			t.Fatalf("Could not parse %q: %v", tt.base, err)
+		}
+		u, err := url.Parse(tt.link)
+		if err != nil {
+			t.Fatalf("Could not parse %q: %v", tt.link, err)
+		}
+		if got := tt.scope.inScope(u, base); got != tt.want {
+			t.Errorf("Scope %d: inScope(%q, %q) = %v, want %v", tt.scope, u, base, got, tt.want)
+		}
+	}
+}
+
+func TestStartScraper_FollowSeedRedirectScope(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// localhost stands for example.com, and 127.0.0.1 for www.example.com.
+		if strings.HasPrefix(r.Host, "localhost:") {
+			http.Redirect(w, r, ts.URL+r.URL.Path, http.StatusMovedPermanently)
+			return
+		}
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><body><a href="%s/about">About</a></body></html>`, ts.URL)
+			return
+		}
+		fmt.Fprint(w, `<html><body>About</body></html>`)
+	}))
+	defer ts.Close()
+	seed := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/"
+
+	crawled := func(cfg Config) []string {
+		t.Helper()
+		result, err := NewScraper(cfg).Run(context.Background(), seed)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		var pages []string
+		for _, page := range result.Pages {
+			pages = append(pages, page.URL)
+		}
+		slices.Sort(pages)
+		return pages
+	}
+
+	if want, got := []string{ts.URL + "/about", seed}, crawled(DefaultConfig()); !slices.Equal(got, want) {
+		t.Errorf("Expected pages %v, got %v", want, got)
+	}
+	cfg := DefaultConfig()
+	cfg.FollowSeedRedirectScope = false
+	if got := crawled(cfg); len(got) != 0 {
+		t.Errorf("Expected nothing to be crawled past the seed redirect, got %v", got)
+	}
+}
+
+func TestStartScraper_InScope(t *testing.T) {
+	var mu sync.Mutex
+	var crawled []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		crawled = append(crawled, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/docs/">Docs</a><a href="/blog/">Blog</a></body></html>`)
+		case "/docs/child":
+			fmt.Fprint(w, `<html><body>No further links</body></html>`)
+		default:
+			fmt.Fprintf(w, `<html><body><a href="%schild">Child</a></body></html>`, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.InScope = func(u *url.URL) bool {
+		return u.Path == "/" || strings.HasPrefix(u.Path, "/docs/")
+	}
+	if _, err := StartScraperWithConfig(ts.URL+"/", cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// The blog is checked, as an external link, but not crawled.
+	slices.Sort(crawled)
+	if want := []string{"/", "/blog/", "/docs/", "/docs/child"}; !slices.Equal(crawled, want) {
+		t.Errorf("Expected requests %v, got %v", want, crawled)
+	}
+}
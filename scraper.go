@@ -1,35 +1,173 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/html"
 )
 
 type ScrapeData struct {
-	base      *url.URL
-	url       *url.URL
-	client    *http.Client
-	deadlinks chan<- *url.URL
-	nextlinks chan<- *url.URL
-	wg        *sync.WaitGroup
+	*WorkerData
+	job *job
+	// handedBack is set if the job was handed back to the link handler,
+	// to be dispatched once its host is ready.
+	handedBack bool
 }
 
 type WorkerData struct {
+	cfg       *Config
 	base      *url.URL
 	client    *http.Client
-	deadlinks chan<- *url.URL
-	nextlinks chan<- *url.URL
-	jobs      <-chan *url.URL
+	deadlinks chan<- *DeadLink
+	nextlinks chan<- []*job
+	jobs      <-chan *job
 	wg        *sync.WaitGroup
+	// canonicals holds the canonical URLs whose links have been extracted.
+	canonicals *stringSet
+	// seedErr is set by the worker that scrapes the seed if it fails.
+	seedErr error
+	// collector gathers everything but dead links for the result.
+	collector *collector
+	// parseSem bounds concurrent HTML parsing. It is nil when unbounded.
+	parseSem chan struct{}
+	// inFlight bounds concurrent requests. It is nil when unbounded.
+	inFlight chan struct{}
+	// limiter is nil unless Config.AdaptiveConcurrency is set, and then
+	// replaces inFlight.
+	limiter *adaptiveLimiter
+	// pacer is nil unless Config.LatencyTargetMillis is set.
+	pacer *latencyPacer
+	// hostSlots is nil unless Config.DefaultHostConcurrency or
+	// Config.HostConcurrency is set.
+	hostSlots *hostSlots
+	// robots is nil unless Config.RespectRobots is set.
+	robots   *robotsCache
+	throttle *hostThrottle
+	// breaker is nil unless Config.CircuitBreakerThreshold is set.
+	breaker *circuitBreaker
+	stats   *crawlStats
+	// previous is nil unless Config.Previous is set.
+	previous *previousCrawl
+	// watchdog is nil unless Config.MaxIdleTime is set.
+	watchdog *watchdog
+	// hostBudget is nil unless Config.MaxDurationPerHost is set.
+	hostBudget *hostBudget
+	// tokens is nil unless Config.TokenProvider is set.
+	tokens *tokenSource
+	// humanizer is nil unless Config.HumanizeDelay is set.
+	humanizer *humanizer
+	// httpsHosts is nil unless Config.UpgradeToHTTPS is set.
+	httpsHosts *httpsHosts
+	// redirectedSeed is where the seed redirected to, if that is off the
+	// site and Config.FollowSeedRedirectScope is set.
+	redirectedSeed atomic.Pointer[url.URL]
+	// handback takes the jobs whose host is not ready back to the link
+	// handler. It is nil unless Config.StealWork is set.
+	handback chan *job
+	// logger is the default logger, with the Config.Label of the crawl.
+	logger *slog.Logger
+}
+
+// job is a URL waiting to be checked, along with where it was found.
+type job struct {
+	url        *url.URL
+	referrer   *url.URL
+	anchorText string
+	// fromSitemap is set for URLs taken from Config.Sitemap.
+	fromSitemap bool
+	// fromSeeds is set for URLs taken from Config.Seeds.
+	fromSeeds bool
+	// userinfo holds the credentials split off url, so that they are only
+	// ever sent and never logged or reported.
+	userinfo *url.Userinfo
+	// rel tells what kind of resource url is, such as "preload" for a
+	// resource hint or "srcset" for an image candidate. It is empty for
+	// anchors.
+	rel string
+	// previous is the outcome of a previous crawl to report again instead
+	// of fetching url.
+	previous *DeadLink
+	// depth is the number of links followed from the seed.
+	depth int
+	// queued is when the job entered the frontier, and dequeued when a
+	// worker took it.
+	queued   time.Time
+	dequeued time.Time
+}
+
+// link is a URL extracted from a page.
+type link struct {
+	url  *url.URL
+	text string
+	// rel is set for resources, like job.rel.
+	rel string
+	// fragment is the fragment url had before being cleaned, if
+	// Config.CheckFragments is set.
+	fragment string
+}
+
+// page holds what was extracted from an HTML document.
+type page struct {
+	links []link
+	// canonical is the URL declared by <link rel="canonical">, if any.
+	canonical *url.URL
+	// ids lists the anchors a fragment may point at, and localFragments the
+	// fragments of the links to the page itself, if Config.CheckFragments
+	// is set.
+	ids            []string
+	localFragments []string
+	// duplicateIDs lists the id attributes found more than once, if
+	// Config.ReportDuplicateIDs is set.
+	duplicateIDs []string
+	// tooDeep is set if the document is nested deeper than
+	// Config.MaxHTMLDepth, past which links are not looked for.
+	tooDeep bool
+}
+
+// alternates returns the hreflang alternates of p.
+func (p *page) alternates() []string {
+	var alternates []string
+	for _, l := range p.links {
+		if l.rel == "alternate" {
+			alternates = append(alternates, l.url.String())
+		}
+	}
+	return alternates
+}
+
+// stringSet is a set of strings safe for concurrent use.
+type stringSet struct {
+	mu    sync.Mutex
+	items map[string]struct{}
+}
+
+func newStringSet() *stringSet {
+	return &stringSet{items: make(map[string]struct{})}
+}
+
+// add adds item to the set and reports whether it was not already present.
+func (s *stringSet) add(item string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.items[item]; exists {
+		return false
+	}
+	s.items[item] = struct{}{}
+	return true
 }
 
 const (
@@ -38,116 +176,731 @@ const (
 )
 
 func StartScraper(targetUrl string, workersCount int) ([]string, error) {
-	parsedTargetUrl, err := cleanURL(targetUrl, nil)
+	cfg := DefaultConfig()
+	cfg.Workers = workersCount
+	deadlinks, err := StartScraperWithConfig(targetUrl, cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	urls := make([]string, 0, len(deadlinks))
+	for _, deadlink := range deadlinks {
+		urls = append(urls, deadlink.URL)
+	}
+	return urls, nil
+}
+
+func StartScraperWithConfig(targetUrl string, cfg Config) ([]DeadLink, error) {
+	result, err := NewScraper(cfg).Run(context.Background(), targetUrl)
+	return result.DeadLinks, err
+}
+
+// Scraper crawls a website looking for dead links. It can be reused for
+// several crawls, and its methods may be called while a crawl is running.
+type Scraper struct {
+	cfg Config
+
+	mu sync.Mutex
+	// resumed is non-nil while the scraper is paused, and is closed when
+	// it is resumed.
+	resumed chan struct{}
+	// paused wakes the link handler when Pause is called.
+	paused chan struct{}
+	// pool runs the workers of the current crawl, if any.
+	pool *workerPool
+	// stats tracks the progress of the current crawl, if any.
+	stats *crawlStats
+	// frontierSize mirrors the length of the current crawl's frontier,
+	// which only the link handler may touch.
+	frontierSize atomic.Int64
+	// transport replaces the network, for ReplayScraper.
+	transport http.RoundTripper
+}
+
+func NewScraper(cfg Config) *Scraper {
+	return &Scraper{
+		cfg:    cfg,
+		paused: make(chan struct{}, 1),
+	}
+}
+
+// Pause stops dispatching new jobs. Requests already in flight are allowed
+// to finish.
+func (s *Scraper) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+	select {
+	case s.paused <- struct{}{}:
+	default:
+	}
+}
+
+// Resume continues a paused crawl.
+func (s *Scraper) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// Scale changes the number of workers of the running crawl. Removed
+// workers finish their current job before exiting, and at least one worker
+// is always kept. It has no effect when no crawl is running.
+func (s *Scraper) Scale(n int) {
+	s.mu.Lock()
+	pool := s.pool
+	s.mu.Unlock()
+	if pool != nil {
+		pool.scale(n)
+	}
+}
+
+// Stats reports the progress of the running crawl. It is zero when no
+// crawl is running.
+func (s *Scraper) Stats() Stats {
+	s.mu.Lock()
+	stats, pool := s.stats, s.pool
+	s.mu.Unlock()
+	if stats == nil {
+		return Stats{}
+	}
+	snapshot := stats.snapshot()
+	snapshot.Workers = pool.size()
+	return snapshot
+}
+
+// FrontierSize returns the number of URLs waiting in the frontier of the
+// running crawl, not counting those being checked. It is zero when no crawl
+// is running.
+func (s *Scraper) FrontierSize() int {
+	return int(s.frontierSize.Load())
+}
+
+// resumedChan returns a channel that is closed once the scraper is
+// resumed, or nil if it is not paused.
+func (s *Scraper) resumedChan() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumed
+}
+
+// Run crawls targetUrl and returns what was found. If the crawl stops
+// early, the partial result is returned along with the error.
+func (s *Scraper) Run(ctx context.Context, targetUrl string) (Result, error) {
+	cfg := s.cfg
+	parsedTargetUrl, err := cleanURL(targetUrl, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrInvalidSeed, err)
+	}
+	if parsedTargetUrl.Scheme != "http" && parsedTargetUrl.Scheme != "https" {
+		return Result{}, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidSeed, parsedTargetUrl.Scheme)
+	}
+	parsedTargetUrl = cfg.canonicalHost(parsedTargetUrl)
+
+	seeds := []*job{{url: parsedTargetUrl}}
+	for _, seed := range cfg.Seeds {
+		u, err := cleanURL(seed, nil)
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %w", ErrInvalidSeed, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return Result{}, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidSeed, u.Scheme)
+		}
+		seeds = append(seeds, &job{url: u, fromSeeds: true})
+	}
+
+	transport := s.transport
+	if transport == nil {
+		networkTransport, err := newTransport(&cfg)
+		if err != nil {
+			return Result{}, err
+		}
+		transport = networkTransport
+	}
+	var recorder *harRecorder
+	if cfg.RecordHAR != "" {
+		recorder = &harRecorder{next: transport, limit: cfg.maxBodyBytes()}
+		transport = recorder
+	}
+	// Timeouts are applied per request in scrapePage, so that slow hosts
+	// can be given a longer deadline.
 	client := &http.Client{
-		Timeout: Timeout * time.Second,
+		Transport: transport,
 	}
+	defer client.CloseIdleConnections()
+	// Only page requests leave redirects to be reported, not those of
+	// robots.txt or the sitemap.
+	crawlClient := client
+	if !cfg.FollowRedirects {
+		crawlClient = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	// A stalled crawl cancels crawlCtx, but not the caller's ctx.
+	crawlCtx, cancelCrawl := context.WithCancelCause(ctx)
+	defer cancelCrawl(nil)
+	parentCtx := ctx
+	ctx = crawlCtx
 
 	var wg sync.WaitGroup
-	deadlinks := make(chan *url.URL, ChannelCap)
-	allDeadlinks := make([]string, 0)
-	nextlinks := make(chan *url.URL, ChannelCap)
-	jobs := make(chan *url.URL, ChannelCap)
+	// background counts the goroutines of the crawl other than the workers
+	// and the dead link collector.
+	var background sync.WaitGroup
+	deadlinks := make(chan *DeadLink, ChannelCap)
+	allDeadlinks := make([]DeadLink, 0)
+	// Both channels are unbuffered, so that the link handler alone decides
+	// the order in which jobs are dispatched.
+	nextlinks := make(chan []*job)
+	jobs := make(chan *job)
 	visitedLinks := make(map[string]struct{}, ChannelCap)
-	ctx := context.Background()
+
+	collector := newCollector()
+	startTime := time.Now()
 
 	// Start workers
 	data := &WorkerData{
-		base:      parsedTargetUrl,
-		client:    client,
-		deadlinks: deadlinks,
-		nextlinks: nextlinks,
-		jobs:      jobs,
-		wg:        &wg,
+		cfg:        &cfg,
+		base:       parsedTargetUrl,
+		client:     crawlClient,
+		deadlinks:  deadlinks,
+		nextlinks:  nextlinks,
+		jobs:       jobs,
+		wg:         &wg,
+		canonicals: newStringSet(),
+		collector:  collector,
+		throttle:   newHostThrottle(),
+		stats:      newCrawlStats(startTime),
+		logger:     slog.Default(),
+	}
+	if cfg.Label != "" {
+		data.logger = data.logger.With("label", cfg.Label)
+	}
+	if cfg.RespectRobots {
+		data.robots = newRobotsCache(client, &cfg, data.log())
+	}
+	if cfg.Previous != nil {
+		data.previous = newPreviousCrawl(cfg.Previous)
+	}
+	if cfg.TokenProvider != nil {
+		data.tokens = newTokenSource(cfg.TokenProvider)
+	}
+	if cfg.HumanizeDelay > 0 {
+		data.humanizer = newHumanizer(cfg.HumanizeDelay, cfg.HumanizeSeed)
+	}
+	if cfg.UpgradeToHTTPS {
+		data.httpsHosts = newHTTPSHosts()
+	}
+	if cfg.MaxIdleTime > 0 {
+		data.watchdog = newWatchdog(cfg.MaxIdleTime)
+		paused := func() bool { return s.resumedChan() != nil }
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			data.watchdog.run(ctx, paused, func() {
+				data.log().Error(fmt.Sprintf("No URL checked for %s, aborting", cfg.MaxIdleTime))
+				cancelCrawl(fmt.Errorf("%w: no URL checked for %s", ErrIdleTimeout, cfg.MaxIdleTime))
+			})
+		}()
+	}
+	if cfg.MaxDurationPerHost > 0 {
+		data.hostBudget = newHostBudget(cfg.MaxDurationPerHost)
 	}
-	for range workersCount {
-		go worker(data, ctx)
+	if cfg.CircuitBreakerThreshold > 0 {
+		data.breaker = newCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown, data.log())
 	}
+	if cfg.MaxParseConcurrency > 0 {
+		data.parseSem = make(chan struct{}, cfg.MaxParseConcurrency)
+	}
+	if cfg.AdaptiveConcurrency {
+		data.limiter = newAdaptiveLimiter(cmp.Or(cfg.MaxInFlight, cfg.Workers), data.log())
+	} else if cfg.MaxInFlight > 0 {
+		data.inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.LatencyTargetMillis > 0 {
+		data.pacer = newLatencyPacer(time.Duration(cfg.LatencyTargetMillis)*time.Millisecond, data.log())
+	}
+	if cfg.DefaultHostConcurrency > 0 || len(cfg.HostConcurrency) > 0 {
+		data.hostSlots = newHostSlots()
+	}
+	if cfg.StealWork {
+		data.handback = make(chan *job)
+	}
+	var started atomic.Int32
+	pool := newWorkerPool(func(quit <-chan struct{}) {
+		// Only the initial workers are staggered, not those added by Scale.
+		// A worker removed by Scale before its start exits right away.
+		if n := int(started.Add(1)) - 1; n < cfg.Workers {
+			stagger := time.NewTimer(time.Duration(n) * cfg.WorkerStartStagger)
+			defer stagger.Stop()
+			select {
+			case <-stagger.C:
+			case <-ctx.Done():
+			case <-quit:
+				return
+			}
+		}
+		worker(data, ctx, quit)
+	})
+	pool.scale(cfg.Workers)
+	s.mu.Lock()
+	s.pool = pool
+	s.stats = data.stats
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.pool = nil
+		s.stats = nil
+		s.mu.Unlock()
+	}()
+
+	// verify starts the second phase of a TwoPhase crawl. The link handler
+	// closes the given channel once the deferred links are queued.
+	verify := make(chan chan struct{})
 
-	// Start new link handler
+	// Start new link handler. It owns the frontier, and dispatches jobs from
+	// it whenever a worker is free and the scraper is not paused.
+	budgetExceeded := false
+	background.Add(1)
 	go func() {
-		for nextlink := range nextlinks {
-			slog.Debug(fmt.Sprintf("Processing %s", nextlink))
-			if _, exists := visitedLinks[nextlink.String()]; exists {
-				wg.Done()
-				continue
+		defer background.Done()
+		// deferred holds the links left for the verification phase of a
+		// TwoPhase crawl.
+		var deferred []*job
+		discovering := cfg.TwoPhase
+		frontier := newDispatchQueue(&cfg)
+		// shards holds the jobs waiting for their host, if work is stolen.
+		var shards *hostShards
+		if cfg.StealWork {
+			shards = newHostShards(data.throttle)
+		}
+		var traps *trapDetector
+		if cfg.MaxTemplateHits > 0 {
+			traps = newTrapDetector(cfg.MaxTemplateHits)
+		}
+		accepted := 0
+		cancelled := false
+		done := ctx.Done()
+		for {
+			now := time.Now()
+			for frontier.len() > 0 && shards.blocked(frontier.peek().url.Host, now) {
+				shards.park(frontier.pop())
+			}
+			s.frontierSize.Store(int64(frontier.len() + shards.len()))
+			var out chan<- *job
+			var next *job
+			resumed := s.resumedChan()
+			sharded := false
+			if resumed == nil {
+				if next = shards.next(now); next != nil {
+					sharded = true
+				} else if frontier.len() > 0 {
+					next = frontier.peek()
+				}
+				if next != nil {
+					out = jobs
+				}
+			}
+			var wake <-chan time.Time
+			if at, ok := shards.wake(); ok && resumed == nil && next == nil {
+				wake = time.After(at.Sub(now))
+			}
+
+			select {
+			case batch, ok := <-nextlinks:
+				if !ok {
+					return
+				}
+				newlinks := make([]*job, 0, len(batch))
+				for _, nextlink := range batch {
+					nextlink.splitUserinfo(cfg.StripUserInfo)
+					nextlink.url = data.normalizeLink(nextlink.url)
+					data.log().Debug(fmt.Sprintf("Processing %s", nextlink.url))
+					key := cfg.visitKey(nextlink.url)
+					if _, exists := visitedLinks[key]; exists {
+						wg.Done()
+						continue
+					}
+					visitedLinks[key] = struct{}{}
+					// The https version of the link may be crawled instead.
+					if data.upgradable(nextlink.url) {
+						upgradedKey := cfg.visitKey(httpsVersion(nextlink.url))
+						if _, exists := visitedLinks[upgradedKey]; exists {
+							wg.Done()
+							continue
+						}
+						visitedLinks[upgradedKey] = struct{}{}
+					}
+					if cancelled {
+						wg.Done()
+						continue
+					}
+					if cfg.skipExtension(nextlink.url) {
+						data.log().Debug(fmt.Sprintf("Skipping by extension: %s", nextlink.url))
+						wg.Done()
+						continue
+					}
+					if cfg.tooLong(nextlink.url) {
+						data.log().Info(fmt.Sprintf("Skipping URL longer than %d bytes: %.100s...", cfg.maxURLLength(), nextlink.url))
+						collector.addSkipped(nextlink.url.String())
+						wg.Done()
+						continue
+					}
+					if ok, trap := traps.allow(nextlink.url); !ok {
+						if trap != "" {
+							data.log().Warn(fmt.Sprintf("Possible crawler trap, not crawling more than %d pages like %s", cfg.MaxTemplateHits, trap))
+							collector.addTrap(trap)
+						}
+						wg.Done()
+						continue
+					}
+					if cfg.MaxPages > 0 && accepted >= cfg.MaxPages {
+						budgetExceeded = true
+						wg.Done()
+						continue
+					}
+					accepted++
+					collector.addDiscovered(nextlink)
+					// Sitemap URLs are only queued once the crawl from the
+					// seed is over, so unvisited ones are unreachable from it.
+					if nextlink.fromSitemap {
+						data.log().Info(fmt.Sprintf("Found orphan page: %s", nextlink.url))
+						collector.addOrphan(nextlink.url.String())
+					}
+					// Links that cannot lead to more pages wait for phase two.
+					if discovering && (!isPageRel(nextlink.rel) || !data.inScope(nextlink.url)) {
+						deferred = append(deferred, nextlink)
+						wg.Done()
+						continue
+					}
+					newlinks = append(newlinks, nextlink)
+				}
+				frontier.push(newlinks...)
+				data.stats.queue(len(newlinks))
+			case out <- next:
+				if sharded {
+					shards.remove(next)
+				} else {
+					frontier.pop()
+				}
+			case j := <-data.handback:
+				if cancelled {
+					data.stats.drop()
+					wg.Done()
+					continue
+				}
+				shards.park(j)
+			case <-wake:
+			case ack := <-verify:
+				discovering = false
+				if !cancelled {
+					wg.Add(len(deferred))
+					frontier.push(deferred...)
+					data.stats.queue(len(deferred))
+				}
+				deferred = nil
+				close(ack)
+			case <-resumed:
+			case <-s.paused:
+			case <-done:
+				// Once cancelled, remaining links are dropped so the crawl drains.
+				cancelled = true
+				done = nil
+				for frontier.len() > 0 {
+					frontier.pop()
+					data.stats.drop()
+					wg.Done()
+				}
+				for range shards.drain() {
+					data.stats.drop()
+					wg.Done()
+				}
 			}
-			visitedLinks[nextlink.String()] = struct{}{}
-			jobs <- nextlink
 		}
 	}()
 
 	// Start deadlink slice updater
 	var deadlinkWg sync.WaitGroup
 	deadlinkWg.Add(1)
+	var stream *streamWriter
+	if cfg.StreamWriter != nil {
+		stream = newStreamWriter(cfg.StreamWriter)
+	}
+	// truncated is set by the collector once Config.MaxDeadLinks is
+	// reached, and read after deadlinkWg.Wait.
+	truncated := false
 	go func() {
 		for deadlink := range deadlinks {
-			allDeadlinks = append(allDeadlinks, deadlink.String())
+			if truncated {
+				continue
+			}
+			if cfg.MaxDeadLinks > 0 && len(allDeadlinks) == cfg.MaxDeadLinks {
+				data.log().Error(fmt.Sprintf("Found %d dead links, aborting", cfg.MaxDeadLinks))
+				truncated = true
+				cancelCrawl(fmt.Errorf("%w: %d dead links found", ErrTooManyDeadLinks, cfg.MaxDeadLinks))
+				continue
+			}
+			deadlink.FoundAt = time.Now()
+			allDeadlinks = append(allDeadlinks, *deadlink)
+			if stream != nil {
+				if err := stream.write(deadlink); err != nil {
+					data.log().Error(fmt.Sprintf("Could not stream dead link %s: %s", deadlink.URL, err.Error()))
+				}
+			}
 		}
 		deadlinkWg.Done()
 	}()
 
-	// Add first job
-	wg.Add(1)
-	nextlinks <- parsedTargetUrl
+	// Add first jobs
+	wg.Add(len(seeds))
+	nextlinks <- seeds
 
 	wg.Wait()
 
-	slog.Info("Done scraping, closing channels")
+	if cfg.Sitemap != "" && ctx.Err() == nil {
+		s.crawlSitemap(ctx, client, &wg, nextlinks, data.log())
+	}
+
+	if cfg.TwoPhase {
+		data.log().Info("Done discovering, verifying links")
+		ack := make(chan struct{})
+		verify <- ack
+		<-ack
+		wg.Wait()
+	}
+
+	data.log().Info("Done scraping, closing channels")
 	close(nextlinks)
 	close(jobs)
 	close(deadlinks)
 	deadlinkWg.Wait()
 
-	slog.Debug("Returning")
-	return allDeadlinks, nil
+	data.log().Debug("Returning")
+	result := collector.result
+	seedURL := *parsedTargetUrl
+	seedURL.User = nil
+	result.Seed = seedURL.String()
+	result.Label = cfg.Label
+	result.CompressReport = cfg.CompressReport
+	result.DeadLinks = allDeadlinks
+	sortDeadLinks(result.DeadLinks, cfg.SortResults)
+	result.DeadLinksTruncated = truncated
+	result.Duration = time.Since(startTime)
+	if cfg.CheckSocialMeta {
+		result.SocialMetaIssues = socialMetaIssues(result.DeadLinks)
+	}
+	result.QueueWait, result.ServiceTime = data.stats.latencies()
+	result.Throughput = data.stats.throughput(len(result.Pages), result.Duration)
+	if cfg.CheckHreflangReciprocity {
+		result.HreflangIssues = missingReciprocity(collector.alternates, data.log())
+	}
+	dead := make(map[string]struct{}, len(allDeadlinks))
+	for _, deadLink := range allDeadlinks {
+		key := deadLink.URL
+		if u, err := url.Parse(deadLink.URL); err == nil {
+			key = data.linkKey(u)
+		}
+		dead[key] = struct{}{}
+	}
+	if cfg.CheckFragments {
+		result.BrokenFragments = brokenFragments(collector.anchors, collector.fragmentLinks, dead, data.log())
+	}
+	if cfg.DegradedThreshold > 0 {
+		result.DegradedPages = degradedPages(collector.assets, dead, cfg.DegradedThreshold, data.log())
+	}
+	result.SelfLinks = selfLinks(result.Pages)
+	if cfg.MinCycleSize > 0 {
+		result.LinkCycles = linkCycles(result.Pages, cfg.MinCycleSize)
+	}
+	if len(cfg.Seeds) > 0 {
+		// The link handler has normalized the seed URLs by now.
+		seedURLs := make([]string, len(seeds))
+		for i, seed := range seeds {
+			seedURLs[i] = seed.url.String()
+		}
+		result.ReachabilityBySeed = reachabilityBySeed(result.Pages, seedURLs)
+	}
+	var harErr error
+	if recorder != nil {
+		harErr = recorder.save(cfg.RecordHAR)
+	}
+	var runErr error
+	switch {
+	// The crawl aborted itself, with the reason as the cause.
+	case ctx.Err() != nil && parentCtx.Err() == nil:
+		runErr = context.Cause(ctx)
+	case ctx.Err() != nil:
+		runErr = fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx))
+	case data.seedErr != nil:
+		runErr = fmt.Errorf("%w: %w", ErrSeedUnreachable, data.seedErr)
+	case budgetExceeded:
+		runErr = fmt.Errorf("%w: stopped after %d pages", ErrBudgetExceeded, cfg.MaxPages)
+	case harErr != nil:
+		runErr = fmt.Errorf("could not write HAR: %w", harErr)
+	}
+
+	// Stop the link handler, the workers and the watchdog before the crawl
+	// is reported complete.
+	cancelCrawl(nil)
+	background.Wait()
+	pool.stop()
+	if cfg.OnComplete != nil {
+		cfg.OnComplete(result)
+	}
+	return result, runErr
+}
+
+// isSeed reports whether j is the URL given to Run.
+func (j *job) isSeed() bool {
+	return j.referrer == nil && !j.fromSitemap && !j.fromSeeds
+}
+
+// splitUserinfo moves the credentials of j's URL into j.userinfo, or drops
+// them if strip is set.
+func (j *job) splitUserinfo(strip bool) {
+	if j.url.User == nil {
+		return
+	}
+	if !strip {
+		j.userinfo = j.url.User
+	}
+	withoutUser := *j.url
+	withoutUser.User = nil
+	j.url = &withoutUser
+}
+
+// crawlSitemap queues the URLs of cfg.Sitemap and waits for them to be
+// crawled.
+func (s *Scraper) crawlSitemap(ctx context.Context, client *http.Client, wg *sync.WaitGroup, nextlinks chan<- []*job, logger *slog.Logger) {
+	entries, err := fetchSitemap(ctx, client, &s.cfg, s.cfg.Sitemap)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Could not read sitemap: %s", err.Error()))
+		return
+	}
+
+	batch := make([]*job, 0, len(entries))
+	for _, entry := range entries {
+		if !s.cfg.Since.IsZero() {
+			if lastModified, ok := entry.lastModified(); ok && !lastModified.After(s.cfg.Since) {
+				logger.Debug(fmt.Sprintf("Not modified since %s: %s", s.cfg.Since.Format(time.DateOnly), entry.Loc))
+				continue
+			}
+		}
+		u, err := cleanURL(entry.Loc, nil)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Invalid sitemap URL %q: %s", entry.Loc, err.Error()))
+			continue
+		}
+		batch = append(batch, &job{url: u, fromSitemap: true})
+	}
+	if len(batch) == 0 {
+		return
+	}
+	wg.Add(len(batch))
+	nextlinks <- batch
+	wg.Wait()
 }
 
-func worker(data *WorkerData, ctx context.Context) {
-	for nextlink := range data.jobs {
+func worker(data *WorkerData, ctx context.Context, quit <-chan struct{}) {
+	for {
+		var nextlink *job
+		select {
+		case <-quit:
+			return
+		case j, ok := <-data.jobs:
+			if !ok {
+				return
+			}
+			nextlink = j
+			nextlink.dequeued = time.Now()
+		}
+
 		scrapeData := ScrapeData{
-			base:      data.base,
-			url:       nextlink,
-			client:    data.client,
-			deadlinks: data.deadlinks,
-			nextlinks: data.nextlinks,
-			wg:        data.wg,
+			WorkerData: data,
+			job:        nextlink,
 		}
+		data.stats.active.Add(1)
 		scrapePage(&scrapeData, ctx)
+		data.stats.active.Add(-1)
+		if scrapeData.handedBack {
+			continue
+		}
+		data.stats.time(nextlink.dequeued.Sub(nextlink.queued), time.Since(nextlink.dequeued))
+		data.stats.finish(time.Now())
+		data.watchdog.reset()
 		data.wg.Done()
 	}
 }
 
 func scrapePage(data *ScrapeData, ctx context.Context) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, data.url.String(), nil)
-	if err != nil {
-		slog.Warn("Could not create request")
+	if data.job.previous != nil {
+		data.log().Info(fmt.Sprintf("Reusing previous dead link: %s", data.job.url))
+		deadlink := *data.job.previous
+		data.deadlinks <- &deadlink
+		return
+	}
+	if !data.waitTurn(ctx) {
 		return
 	}
 
-	slog.Info(fmt.Sprintf("Sending request to %s", data.url.String()))
-	resp, err := data.client.Do(req)
+	resp, cancel, err := data.fetch(ctx)
+	defer cancel()
+	if errors.Is(err, errNewRequest) {
+		data.log().Warn(fmt.Sprintf("Could not create request for %s: %s", data.job.url, err.Error()))
+		return
+	}
+	// The crawl being cancelled is not the host's fault.
+	if ctx.Err() == nil {
+		data.breaker.record(data.job.url.Host, err != nil || retryableStatus(resp.StatusCode))
+	}
 	if err != nil {
+		data.seedFailed(err)
 		// Check if the context was canceled or deadline was exceeded
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			slog.Info(fmt.Sprintf("Request canceled or timed out: %s", data.url))
+			data.log().Info(fmt.Sprintf("Request canceled or timed out: %s: %s", data.job.url, err.Error()))
 			return
 		}
-		slog.Info(fmt.Sprintf("Found dead link: %s, error: %s", data.url, err.Error()))
-		data.deadlinks <- data.url
+		data.log().Info(fmt.Sprintf("Found dead link: %s, error: %s", data.job.url, err.Error()))
+		data.deadlinks <- data.deadLink(nil, err)
+		return
+	}
+	defer closeBody(resp.Body)
+	data.log().Debug(fmt.Sprintf("Request success %s", data.job.url))
+
+	if resp.StatusCode == http.StatusNotModified && data.previous != nil {
+		data.reuse()
+		return
+	}
+
+	if !data.cfg.FollowRedirects && isRedirect(resp.StatusCode) {
+		data.log().Info(fmt.Sprintf("Found redirect: %s -> %s", data.job.url, resp.Header.Get("Location")))
+		data.collector.addRedirect(data.redirect(resp))
 		return
 	}
-	defer resp.Body.Close()
-	slog.Debug(fmt.Sprintf("Request success %s", data.url))
+
+	redirected := resp.Request.Response != nil
+	if redirected && data.cfg.FollowSeedRedirectScope && data.job.isSeed() && !data.inScope(resp.Request.URL) {
+		data.log().Info(fmt.Sprintf("Seed redirected to %s, crawling its site too", resp.Request.URL))
+		data.redirectedSeed.Store(resp.Request.URL)
+	}
+	if redirected && data.inScope(data.job.url) && !data.inScope(resp.Request.URL) {
+		data.log().Info(fmt.Sprintf("Redirected off the site: %s -> %s", data.job.url, resp.Request.URL))
+		data.collector.addExternalRedirect(data.externalRedirect(resp.Request.URL))
+	}
 
 	// Check if this is a dead link
-	if resp.StatusCode >= 400 && resp.StatusCode <= 599 {
-		slog.Info(fmt.Sprintf("Found deadlink: %s, resp: %+v", data.url, resp))
-		data.deadlinks <- data.url
+	if data.cfg.isDead(resp.StatusCode) {
+		data.log().Info(fmt.Sprintf("Found deadlink: %s, resp: %+v", data.job.url, resp))
+		data.seedFailed(fmt.Errorf("status %s", resp.Status))
+		data.deadlinks <- data.deadLink(resp, nil)
 		return
 	}
 
@@ -155,53 +908,732 @@ func scrapePage(data *ScrapeData, ctx context.Context) {
 	// We will now extract all links in this page and send
 	// them to be checked.
 
-	// Stop scraping outside target website
-	if !isSameDomain(data.url, data.base) {
-		slog.Info(fmt.Sprintf("Avoiding leaving domain: %s", data.url))
+	// Stop scraping outside target website. The final URL is checked too,
+	// since an internal link may redirect to an external page. Without a
+	// redirect it is only the URL given by Config.RewriteURL.
+	if !data.inScope(data.job.url) || (redirected && !data.inScope(resp.Request.URL)) {
+		data.log().Info(fmt.Sprintf("Avoiding leaving domain: %s", data.job.url))
+		return
+	}
+	if data.job.rel == "refresh" && !data.cfg.FollowMetaRefresh {
+		data.log().Info(fmt.Sprintf("Not crawling meta refresh target: %s", data.job.url))
+		return
+	}
+
+	var body io.Reader = io.LimitReader(resp.Body, data.cfg.maxBodyBytes())
+	if (data.cfg.IsDeadResponse != nil || data.cfg.FlagEmptyPages) && isHTML(resp) {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			data.log().Error(fmt.Sprintf("Could not read body of %s: %s", data.job.url, err.Error()))
+			return
+		}
+		if data.cfg.IsDeadResponse != nil {
+			dead, err := data.cfg.IsDeadResponse(resp, content)
+			if err != nil {
+				data.log().Warn(fmt.Sprintf("IsDeadResponse failed for %s: %s", data.job.url, err.Error()))
+			}
+			if dead {
+				data.log().Info(fmt.Sprintf("Found deadlink by response: %s", data.job.url))
+				data.seedFailed(errors.New("dead response"))
+				resp.Body = io.NopCloser(bytes.NewReader(content))
+				deadlink := data.deadLink(resp, nil)
+				deadlink.Kind = KindDeadResponse
+				data.deadlinks <- deadlink
+				return
+			}
+		}
+		if data.cfg.FlagEmptyPages && len(bytes.TrimSpace(content)) < max(1, data.cfg.MinBodyBytes) {
+			data.log().Info(fmt.Sprintf("Found empty page: %s", data.job.url))
+			data.collector.addEmptyPage(data.job.url.String())
+		}
+		body = bytes.NewReader(content)
+	}
+
+	// Paginated APIs link to their other pages from the headers, whatever
+	// the content.
+	var headerLinks []link
+	if data.cfg.FollowLinkHeader {
+		headerLinks = paginationLinks(resp.Header.Values("Link"), resp.Request.URL, data.log())
+	}
+
+	mediaType := responseMediaType(resp)
+	if data.cfg.CheckCSSAssets && mediaType == "text/css" {
+		links, err := cssLinks(body, resp.Request.URL, data.log())
+		if err != nil {
+			data.log().Error(fmt.Sprintf("Could not read body of %s: %s", data.job.url, err.Error()))
+			return
+		}
+		data.follow(append(links, headerLinks...))
+		return
+	}
+	// Responses that do not say what they are were always parsed for links,
+	// so they are crawled as HTML.
+	crawledType := mediaType
+	if resp.Header.Get("Content-Type") == "" {
+		crawledType = "text/html"
+	}
+	if !data.cfg.shouldCrawl(crawledType) {
+		data.log().Debug(fmt.Sprintf("Not crawling %s content: %s", mediaType, data.job.url))
+		data.follow(headerLinks)
 		return
 	}
 
-	links, err := extractLinks(resp.Body, data.base)
+	page, err := data.parse(body)
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error extracting links from %s: %s", data.url, err.Error()))
+		data.log().Error(fmt.Sprintf("Error extracting links from %s: %s", data.job.url, err.Error()))
+		return
+	}
+	page.links = append(page.links, headerLinks...)
+	// A page declaring itself canonical does not link to itself.
+	page.links = slices.DeleteFunc(page.links, func(l link) bool {
+		return l.rel == "canonical" && l.url.String() == data.job.url.String()
+	})
+	if isHTML(resp) {
+		livePage := data.livePage(resp)
+		for _, link := range page.links {
+			livePage.Links = append(livePage.Links, link.url.String())
+		}
+		data.collector.addPage(livePage)
+		if data.cfg.CheckHreflangReciprocity {
+			data.collector.addAlternates(data.job.url.String(), page.alternates())
+		}
+		if data.cfg.CheckFragments {
+			data.collector.addAnchors(data.linkKey(data.job.url), page.ids, data.fragmentLinks(page))
+		}
+		if len(page.duplicateIDs) > 0 {
+			data.collector.addDuplicateIDs(data.job.url.String(), page.duplicateIDs)
+		}
+		if data.cfg.CountLinks {
+			data.collector.addLinkCounts(data.job.url.String(), data.countLinks(page.links))
+		}
+		if data.cfg.DegradedThreshold > 0 {
+			data.collector.addAssets(data.job.url.String(), data.assets(page.links))
+		}
+		if !slices.ContainsFunc(page.links, isFollowable) {
+			data.log().Info(fmt.Sprintf("Found dead-end page: %s", data.job.url))
+			data.collector.addDeadEnd(data.job.url.String())
+		}
+	}
+
+	// Pages sharing a canonical URL are duplicates, so only the first one
+	// to be scraped has its links followed.
+	if data.cfg.RespectCanonical {
+		canonical := data.job.url
+		if page.canonical != nil {
+			canonical = page.canonical
+		}
+		if !data.canonicals.add(canonical.String()) {
+			data.log().Info(fmt.Sprintf("Skipping duplicate of %s: %s", canonical, data.job.url))
+			return
+		}
+	}
+
+	data.follow(page.links)
+}
+
+// log returns the logger of the crawl, the default one if unset.
+func (data *WorkerData) log() *slog.Logger {
+	if data.logger == nil {
+		return slog.Default()
+	}
+	return data.logger
+}
+
+// inScope reports whether u belongs to the crawled site: as decided by
+// Config.InScope if set, or else that of the seed or of where it redirected
+// to.
+func (data *WorkerData) inScope(u *url.URL) bool {
+	if data.cfg.InScope != nil {
+		return data.cfg.InScope(u)
+	}
+	if data.cfg.Scope.inScope(u, data.base) {
+		return true
+	}
+	seed := data.redirectedSeed.Load()
+	return seed != nil && data.cfg.Scope.inScope(u, seed)
+}
+
+// normalizeLink returns u on the canonical host, with the trailing slash
+// normalized if it belongs to the site, as links are before they are
+// checked.
+func (data *WorkerData) normalizeLink(u *url.URL) *url.URL {
+	u = data.cfg.canonicalHost(u)
+	if data.inScope(u) {
+		u = data.cfg.normalizeSlash(u)
+	}
+	return u
+}
+
+// linkKey returns the key matching a link to u with the page or dead link
+// it was checked as: u is normalized like the links, without userinfo, and
+// an http URL that may be upgraded stands for its https version.
+func (data *WorkerData) linkKey(u *url.URL) string {
+	stripped := *u
+	stripped.User = nil
+	u = data.normalizeLink(&stripped)
+	if data.upgradable(u) {
+		u = httpsVersion(u)
+	}
+	return data.cfg.visitKey(u)
+}
+
+// fetch sends the GET request of the job. With Config.UpgradeToHTTPS, the
+// https version of an http URL of the site is tried first, and replaces the
+// job's URL if it is live. The first URL of a host probes it over https
+// without retries, and the hosts that did not answer are not tried again.
+func (data *ScrapeData) fetch(ctx context.Context) (*http.Response, context.CancelFunc, error) {
+	original := data.job.url
+	if !data.upgradable(original) {
+		return data.do(ctx, http.MethodGet)
+	}
+	supported, probed := data.httpsHosts.lookup(original.Host)
+	if probed && !supported {
+		return data.do(ctx, http.MethodGet)
+	}
+
+	data.job.url = httpsVersion(original)
+	var resp *http.Response
+	var cancel context.CancelFunc
+	var err error
+	if probed {
+		resp, cancel, err = data.do(ctx, http.MethodGet)
+	} else {
+		resp, cancel, err = data.send(ctx, http.MethodGet, 0)
+		// The crawl being cancelled says nothing about the host.
+		if err == nil || ctx.Err() == nil {
+			data.httpsHosts.record(original.Host, err == nil)
+		}
+	}
+	if err == nil && !data.cfg.isDead(resp.StatusCode) {
+		data.log().Info(fmt.Sprintf("Upgraded %s to https", original))
+		return resp, cancel, nil
+	}
+	if resp != nil {
+		closeBody(resp.Body)
+	}
+	cancel()
+
+	data.log().Info(fmt.Sprintf("Could not upgrade %s to https, falling back to http", original))
+	data.job.url = original
+	return data.do(ctx, http.MethodGet)
+}
+
+// follow queues links found on the job's page to be checked.
+func (data *ScrapeData) follow(links []link) {
+	if data.cfg.Mode == ModeInternalOnly {
+		links = slices.DeleteFunc(links, func(l link) bool {
+			return !data.inScope(l.url)
+		})
+	}
+
+	if len(links) == 0 {
 		return
 	}
 
-	data.wg.Add(len(links))
+	batch := make([]*job, 0, len(links))
 	for _, link := range links {
-		data.nextlinks <- link
+		batch = append(batch, &job{
+			url:        link.url,
+			referrer:   data.job.url,
+			anchorText: link.text,
+			rel:        link.rel,
+			depth:      data.job.depth + 1,
+		})
+	}
+	data.wg.Add(len(batch))
+	data.nextlinks <- batch
+}
+
+// fragmentLinks returns the links of page to anchors of the site, to verify
+// once their targets are crawled.
+func (data *ScrapeData) fragmentLinks(page *page) []fragmentLink {
+	var fragmentLinks []fragmentLink
+	for _, l := range page.links {
+		if l.fragment != "" && data.inScope(l.url) {
+			target := data.normalizeLink(l.url)
+			fragmentLinks = append(fragmentLinks, fragmentLink{
+				target:   target.String(),
+				key:      data.linkKey(target),
+				fragment: l.fragment,
+				referrer: data.job.url.String(),
+			})
+		}
+	}
+	for _, fragment := range page.localFragments {
+		fragmentLinks = append(fragmentLinks, fragmentLink{
+			target:   data.job.url.String(),
+			key:      data.linkKey(data.job.url),
+			fragment: fragment,
+			referrer: data.job.url.String(),
+		})
+	}
+	return fragmentLinks
+}
+
+// countLinks counts links by kind. Resource hints and image candidates are
+// assets, and the other links are pages, in or out of the site.
+func (data *ScrapeData) countLinks(links []link) LinkCounts {
+	var counts LinkCounts
+	for _, l := range links {
+		switch {
+		case isAsset(l.rel):
+			counts.Assets++
+		case data.inScope(l.url):
+			counts.Internal++
+		default:
+			counts.External++
+		}
+	}
+	return counts
+}
+
+// externalRedirect describes the redirects of the job's URL to final, off
+// the site.
+func (data *ScrapeData) externalRedirect(final *url.URL) ExternalRedirect {
+	redirect := ExternalRedirect{
+		URL:        data.job.url.String(),
+		FinalURL:   final.String(),
+		OriginHost: data.job.url.Host,
+		FinalHost:  final.Host,
+	}
+	if data.job.referrer != nil {
+		redirect.Referrer = data.job.referrer.String()
+	}
+	return redirect
+}
+
+// deadLink builds the report entry for the scraped job. Either resp or err
+// is nil, depending on whether a response was received.
+func (data *ScrapeData) deadLink(resp *http.Response, err error) *DeadLink {
+	deadlink := &DeadLink{
+		URL:        data.job.url.String(),
+		AnchorText: data.job.anchorText,
+		Rel:        data.job.rel,
+	}
+	if data.job.referrer != nil {
+		deadlink.Referrer = data.job.referrer.String()
+	}
+	if resp != nil {
+		deadlink.Kind = KindHTTPStatus
+		deadlink.StatusCode = resp.StatusCode
+		if data.cfg.CaptureHeaders {
+			deadlink.Headers = resp.Header.Clone()
+		}
+		if data.cfg.CaptureDeadBody {
+			limit := data.cfg.MaxCapturedBodyBytes
+			if limit <= 0 {
+				limit = DefaultCapturedBodyBytes
+			}
+			body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+			if err != nil {
+				data.log().Warn(fmt.Sprintf("Could not read body of %s: %s", data.job.url, err.Error()))
+			}
+			deadlink.Body = string(body)
+		}
+	}
+	if err != nil {
+		deadlink.Kind = KindNetworkError
+		deadlink.Error = err.Error()
+		if reason, ok := tlsReason(err); ok {
+			deadlink.Kind = KindTLSError
+			deadlink.Reason = reason
+		}
+	}
+	return deadlink
+}
+
+// redirect describes the redirect resp answered the job's URL with.
+func (data *ScrapeData) redirect(resp *http.Response) Redirect {
+	redirect := Redirect{URL: data.job.url.String(), StatusCode: resp.StatusCode}
+	if data.job.referrer != nil {
+		redirect.Referrer = data.job.referrer.String()
+	}
+	if location, err := resp.Location(); err == nil {
+		redirect.Location = location.String()
+	}
+	return redirect
+}
+
+// isRedirect reports whether statusCode redirects to another URL. 304 Not
+// Modified does not.
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// waitTurn applies robots.txt rules, request spacing, latency pacing, the
+// circuit breaker and the per-host time limit to the job. It reports false
+// if the job must not be fetched.
+func (data *ScrapeData) waitTurn(ctx context.Context) bool {
+	delay := data.cfg.RequestDelay
+	if data.robots != nil {
+		rules := data.robots.rules(ctx, data.job.url)
+		path := data.job.url.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if !rules.allowed(path) {
+			data.log().Info(fmt.Sprintf("Disallowed by robots.txt: %s", data.job.url))
+			return false
+		}
+		delay = max(delay, rules.crawlDelay)
+	}
+	delay = max(delay, data.pacer.spacing(data.job.url.Host))
+	if data.breaker.wait(ctx, data.job.url.Host) != nil {
+		return false
+	}
+	if data.handback != nil {
+		if !data.throttle.reserve(data.job.url.Host, delay) {
+			data.log().Debug(fmt.Sprintf("Handing back %s until its host is ready", data.job.url))
+			data.handback <- data.job
+			data.handedBack = true
+			return false
+		}
+	} else if data.throttle.wait(ctx, data.job.url.Host, delay) != nil {
+		return false
+	}
+	if data.humanizer.wait(ctx) != nil {
+		return false
+	}
+	if data.hostBudget.exceeded(data.job.url.Host) {
+		data.log().Info(fmt.Sprintf("Out of time for %s, skipping %s", data.job.url.Host, data.job.url))
+		data.collector.addSkipped(data.job.url.String())
+		return false
+	}
+	return true
+}
+
+// parse extracts the links of body. The body is read in full first, so that
+// only the CPU-bound parsing is subject to MaxParseConcurrency.
+func (data *ScrapeData) parse(body io.Reader) (*page, error) {
+	if data.parseSem != nil {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+		data.parseSem <- struct{}{}
+		defer func() { <-data.parseSem }()
+	}
+
+	page, err := extractLinks(body, data.base, data.cfg, data.log())
+	if err == nil && page.tooDeep {
+		data.log().Warn(fmt.Sprintf("HTML of %s is nested deeper than %d elements, ignoring the rest", data.job.url, data.cfg.maxHTMLDepth()))
 	}
+	return page, err
 }
 
-func extractLinks(respBody io.Reader, base *url.URL) ([]*url.URL, error) {
+// livePage builds the result entry for the scraped job.
+func (data *ScrapeData) livePage(resp *http.Response) Page {
+	livePage := Page{URL: data.job.url.String(), ETag: resp.Header.Get("ETag")}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		livePage.LastModified = lastModified
+	}
+	return livePage
+}
+
+// responseMediaType returns the media type of resp's Content-Type, or "" if
+// it is missing or malformed.
+func responseMediaType(resp *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// isHTML reports whether resp declares an HTML body.
+func isHTML(resp *http.Response) bool {
+	mediaType := responseMediaType(resp)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// seedFailed records err as the reason the crawl failed, if data is
+// scraping the seed.
+func (data *ScrapeData) seedFailed(err error) {
+	if data.job.referrer == nil && !data.job.fromSeeds {
+		data.seedErr = err
+	}
+}
+
+// extractLinks returns the anchors, image srcset candidates, hreflang
+// alternates and canonical URL of an HTML document, along with the other
+// links cfg asks for: resource hints, extra attributes, JSON-LD URLs, URLs
+// of inline scripts and social preview metadata.
+func extractLinks(respBody io.Reader, base *url.URL, cfg *Config, logger *slog.Logger) (*page, error) {
 	doc, err := html.Parse(respBody)
 	if err != nil {
-		slog.Error("Could not parse body")
+		logger.Error("Could not parse body")
 		return nil, err
 	}
 
-	links := make([]*url.URL, 0)
-	var traverse func(*html.Node)
-	traverse = func(n *html.Node) {
+	links := make([]link, 0)
+	var canonical *url.URL
+	var ids, localFragments, duplicateIDs []string
+	// idCounts counts the id attributes, for Config.ReportDuplicateIDs.
+	var idCounts map[string]int
+	if cfg.ReportDuplicateIDs {
+		idCounts = make(map[string]int)
+	}
+	maxDepth := cfg.maxHTMLDepth()
+	tooDeep := false
+	var traverse func(n *html.Node, depth int)
+	traverse = func(n *html.Node, depth int) {
+		if cfg.IgnoreInertContent && isInert(n) {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "link" && canonical == nil &&
+			strings.EqualFold(attrValue(n, "rel"), "canonical") {
+			if href := attrValue(n, "href"); href != "" {
+				if clean, err2 := cleanURL(href, base); err2 == nil {
+					canonical = clean
+				}
+			}
+		}
+		if cfg.CheckCSSAssets && n.Type == html.ElementNode && n.Data == "link" &&
+			slices.ContainsFunc(strings.Fields(attrValue(n, "rel")), func(rel string) bool { return strings.EqualFold(rel, "stylesheet") }) {
+			if href := attrValue(n, "href"); href != "" {
+				if clean, err2 := cleanURL(href, base); err2 != nil {
+					logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+				} else {
+					links = append(links, link{url: clean, rel: "stylesheet"})
+				}
+			}
+		}
+		if cfg.CrawlCanonicalAndAlternate && n.Type == html.ElementNode && n.Data == "link" && !isHreflang(n) {
+			if rel := crawledLinkRel(attrValue(n, "rel")); rel != "" {
+				if href := attrValue(n, "href"); href != "" {
+					if clean, err2 := cleanURL(href, base); err2 != nil {
+						logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+					} else {
+						links = append(links, link{url: clean, rel: rel})
+					}
+				}
+			}
+		}
+		if cfg.CheckResourceHints && n.Type == html.ElementNode && n.Data == "link" {
+			if rel := resourceHint(attrValue(n, "rel")); rel != "" {
+				if href := attrValue(n, "href"); href != "" {
+					clean, err2 := cleanURL(href, base)
+					if err2 != nil {
+						logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+					} else {
+						links = append(links, link{url: clean, rel: rel})
+					}
+				}
+			}
+		}
+		if cfg.CheckSocialMeta {
+			if property, href := socialMeta(n); href != "" {
+				if clean, err2 := cleanURL(href, base); err2 != nil {
+					logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+				} else {
+					links = append(links, link{url: clean, rel: property})
+				}
+			}
+		}
+		if isMetaRefresh(n) {
+			if target := parseMetaRefresh(attrValue(n, "content")); target != "" {
+				if clean, err2 := cleanURL(target, base); err2 != nil {
+					logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+				} else {
+					links = append(links, link{url: clean, rel: "refresh"})
+				}
+			}
+		}
+		if isHreflang(n) {
+			if clean, err2 := cleanURL(attrValue(n, "href"), base); err2 != nil {
+				logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+			} else {
+				links = append(links, link{url: clean, rel: "alternate"})
+			}
+		}
+		if n.Type == html.ElementNode && (n.Data == "img" || n.Data == "source") {
+			for _, candidate := range parseSrcset(attrValue(n, "srcset")) {
+				clean, err2 := cleanURL(candidate, base)
+				if err2 != nil {
+					logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+					continue
+				}
+				links = append(links, link{url: clean, rel: "srcset"})
+			}
+		}
+		if n.Type == html.ElementNode && len(cfg.ExtraAttributes) > 0 {
+			for _, key := range cfg.ExtraAttributes {
+				if href := attrValue(n, key); href != "" {
+					clean, err2 := cleanURL(href, base)
+					if err2 != nil {
+						logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+						continue
+					}
+					links = append(links, link{url: clean, text: textContent(n, maxDepth-depth)})
+				}
+			}
+		}
+		if cfg.ParseJSONLD && n.Type == html.ElementNode && n.Data == "script" &&
+			strings.EqualFold(attrValue(n, "type"), "application/ld+json") {
+			var text string
+			if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+				text = n.FirstChild.Data
+			}
+			for _, href := range jsonLDURLs(text, logger) {
+				clean, err2 := cleanURL(href, base)
+				if err2 != nil {
+					logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+					continue
+				}
+				links = append(links, link{url: clean})
+			}
+		}
+		if cfg.ScanInlineJS {
+			for _, script := range inlineJS(n) {
+				for _, href := range jsURLs(script) {
+					clean, err2 := cleanURL(href, base)
+					if err2 != nil {
+						logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+						continue
+					}
+					links = append(links, link{url: clean})
+				}
+			}
+		}
+		if cfg.ReportDuplicateIDs && n.Type == html.ElementNode {
+			if id := attrValue(n, "id"); id != "" {
+				idCounts[id]++
+				if idCounts[id] == 2 {
+					duplicateIDs = append(duplicateIDs, id)
+				}
+			}
+		}
+		if cfg.CheckFragments && n.Type == html.ElementNode {
+			if id := attrValue(n, "id"); id != "" {
+				ids = append(ids, id)
+			}
+			if name := attrValue(n, "name"); name != "" && n.Data == "a" {
+				ids = append(ids, name)
+			}
+		}
 		if n.Type == html.ElementNode && n.Data == "a" {
 			for _, attr := range n.Attr {
 				if attr.Key == "href" {
-					link := attr.Val
-					clean, err2 := cleanURL(link, base)
+					// Empty and fragment-only hrefs refer to the page itself.
+					if href := strings.TrimSpace(attr.Val); href == "" || href[0] == '#' {
+						if cfg.CheckFragments && len(href) > 1 {
+							localFragments = append(localFragments, fragment(href))
+						}
+						continue
+					}
+					clean, err2 := cleanURL(attr.Val, base)
 					if err2 != nil {
-						slog.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
+						logger.Error(fmt.Sprintf("Failed to clean URL: %s", err2.Error()))
 						continue
 					}
-					links = append(links, clean)
+					l := link{url: clean, text: textContent(n, maxDepth-depth)}
+					if cfg.CheckFragments {
+						l.fragment = fragment(attr.Val)
+					}
+					links = append(links, l)
 				}
 			}
 		}
+		if depth >= maxDepth {
+			if n.FirstChild != nil {
+				tooDeep = true
+			}
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			traverse(child, depth+1)
+		}
+	}
+	traverse(doc, 0)
+	return &page{links: links, canonical: canonical, ids: ids, localFragments: localFragments, duplicateIDs: duplicateIDs, tooDeep: tooDeep}, nil
+}
+
+// resourceHint returns the resource hint named by a rel attribute that
+// should be checked, or "". Only preload, modulepreload and prefetch point
+// at resources; dns-prefetch and preconnect only name a host to connect to.
+func resourceHint(rel string) string {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		switch token {
+		case "preload", "modulepreload", "prefetch":
+			return token
+		}
+	}
+	return ""
+}
+
+// crawledLinkRel returns "canonical" or "alternate" if a rel attribute
+// names the page's canonical URL or an alternate version of it, and ""
+// otherwise.
+func crawledLinkRel(rel string) string {
+	rels := strings.Fields(strings.ToLower(rel))
+	switch {
+	case slices.Contains(rels, "canonical"):
+		return "canonical"
+	case slices.Contains(rels, "alternate"):
+		return "alternate"
+	}
+	return ""
+}
+
+// isInert reports whether n is an element whose content is not part of the
+// page, a <template>.
+func isInert(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Data == "template"
+}
+
+// isFollowable reports whether l leads to another web page, unlike, say, a
+// mailto: link.
+func isFollowable(l link) bool {
+	return isPageRel(l.rel) && (l.url.Scheme == "http" || l.url.Scheme == "https")
+}
+
+// isAsset reports whether links with rel are resources of the page, such
+// as images or stylesheets, rather than other pages.
+func isAsset(rel string) bool {
+	return !isPageRel(rel) && rel != "alternate" && rel != "og:url"
+}
+
+// isPageRel reports whether links with rel are navigated to, like anchors,
+// meta refreshes and canonical URLs, rather than loaded as resources.
+func isPageRel(rel string) bool {
+	return rel == "" || rel == "refresh" || rel == "canonical"
+}
+
+// attrValue returns the value of n's attribute key, or "" if it is unset.
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns the concatenated text of all text nodes under n,
+// down to maxDepth levels, with runs of whitespace collapsed.
+func textContent(n *html.Node, maxDepth int) string {
+	var sb strings.Builder
+	var collect func(n *html.Node, depth int)
+	collect = func(n *html.Node, depth int) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		if depth >= maxDepth {
+			return
+		}
 		for child := n.FirstChild; child != nil; child = child.NextSibling {
-			traverse(child)
+			collect(child, depth+1)
 		}
 	}
-	traverse(doc)
-	return links, nil
+	collect(n, 0)
+	return strings.Join(strings.Fields(sb.String()), " ")
 }
 
 func isSameDomain(url1 *url.URL, url2 *url.URL) bool {
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"runtime"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestStartScraper_Valid(t *testing.T) {
@@ -50,3 +63,1658 @@ func TestStartScraper_InvalidURL(t *testing.T) {
 		t.Errorf("Expected error for invalid URL, got nil")
 	}
 }
+
+func TestStartScraper_SlowHosts(t *testing.T) {
+	// The slow page takes a while to respond and links to a dead page.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/slow">slow</a></body></html>`)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Without an override the slow page times out, so its links are never seen.
+	cfg := DefaultConfig()
+	cfg.Timeout = 20 * time.Millisecond
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected no dead links, got: %v", deadLinks)
+	}
+
+	// With a longer deadline for this host the slow page loads.
+	host := strings.TrimPrefix(ts.URL, "http://")
+	cfg.SlowHosts = map[string]time.Duration{host: time.Second}
+	deadLinks, err = StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expectedDead := ts.URL + "/dead"
+	if findDeadLink(deadLinks, expectedDead) == nil {
+		t.Errorf("Expected dead link %q not found in: %v", expectedDead, deadLinks)
+	}
+}
+
+func TestStartScraper_RequestContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/slow">slow</a><a href="/other">other</a></body></html>`)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a></body></html>`)
+		case "/other":
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(w, `<html><body><a href="/gone">gone</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Only the slow page gets a deadline too short for it, whatever Timeout
+	// says, so only its links are never seen.
+	cfg := DefaultConfig()
+	cfg.Timeout = time.Millisecond
+	var mu sync.Mutex
+	created, cancelled := 0, 0
+	cfg.RequestContext = func(parent context.Context, u *url.URL) (context.Context, context.CancelFunc) {
+		timeout := time.Second
+		if u.Path == "/slow" {
+			timeout = 20 * time.Millisecond
+		}
+		mu.Lock()
+		created++
+		mu.Unlock()
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		return ctx, func() {
+			mu.Lock()
+			cancelled++
+			mu.Unlock()
+			cancel()
+		}
+	}
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, ts.URL+"/dead") != nil {
+		t.Errorf("Expected the slow page to time out, got: %v", deadLinks)
+	}
+	if findDeadLink(deadLinks, ts.URL+"/gone") == nil {
+		t.Errorf("Expected the other page to load despite Timeout, got: %v", deadLinks)
+	}
+	if created == 0 || cancelled != created {
+		t.Errorf("Expected each of the %d request contexts to be cancelled, got %d", created, cancelled)
+	}
+}
+
+func TestStartScraper_AnchorText(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/foo">foo</a></body></html>`)
+		case "/foo":
+			// Anchor text is split across nested elements.
+			fmt.Fprintf(w, `<html><body><a href="/dead"><b>Download</b>
+				<span>here</span></a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	deadLinks, err := StartScraperWithConfig(ts.URL, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	deadLink := findDeadLink(deadLinks, ts.URL+"/dead")
+	if deadLink == nil {
+		t.Fatalf("Expected dead link not found in: %v", deadLinks)
+	}
+	if deadLink.AnchorText != "Download here" {
+		t.Errorf("Expected anchor text %q, got %q", "Download here", deadLink.AnchorText)
+	}
+	if deadLink.Referrer != ts.URL+"/foo" {
+		t.Errorf("Expected referrer %q, got %q", ts.URL+"/foo", deadLink.Referrer)
+	}
+}
+
+// findDeadLink returns the entry for u in deadLinks, or nil.
+func findDeadLink(deadLinks []DeadLink, u string) *DeadLink {
+	for i := range deadLinks {
+		if deadLinks[i].URL == u {
+			return &deadLinks[i]
+		}
+	}
+	return nil
+}
+
+func TestStartScraper_Modes(t *testing.T) {
+	// The external site links to pages of its own, which must never be fetched.
+	var externalMu sync.Mutex
+	externalHits := make([]string, 0)
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		externalMu.Lock()
+		externalHits = append(externalHits, r.URL.Path)
+		externalMu.Unlock()
+		switch r.URL.Path {
+		case "/", "/landing":
+			fmt.Fprintf(w, `<html><body><a href="/deeper">deeper</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="%s">ext</a><a href="%s/missing">missing</a><a href="/redirect">redirect</a></body></html>`,
+				external.URL, external.URL)
+		case "/redirect":
+			// An internal link landing on an external page.
+			http.Redirect(w, r, external.URL+"/landing", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer internal.Close()
+
+	deadLinks, err := StartScraperWithConfig(internal.URL, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, external.URL+"/missing") == nil {
+		t.Errorf("Expected external dead link to be reported, got: %v", deadLinks)
+	}
+	if slices.Contains(externalHits, "/deeper") {
+		t.Errorf("Links on external pages must not be fetched, external hits: %v", externalHits)
+	}
+
+	externalHits = externalHits[:0]
+	cfg := DefaultConfig()
+	cfg.Mode = ModeInternalOnly
+	deadLinks, err = StartScraperWithConfig(internal.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, external.URL+"/missing") != nil {
+		t.Errorf("Expected external links to be ignored, got: %v", deadLinks)
+	}
+	if slices.Contains(externalHits, "/") || slices.Contains(externalHits, "/missing") {
+		t.Errorf("Expected no direct external requests, external hits: %v", externalHits)
+	}
+}
+
+func TestScraper_PauseResume(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewScraper(DefaultConfig())
+	s.Pause()
+
+	type result struct {
+		deadLinks []DeadLink
+		err       error
+	}
+	done := make(chan result)
+	go func() {
+		res, err := s.Run(context.Background(), ts.URL)
+		done <- result{res.DeadLinks, err}
+	}()
+
+	// Nothing is dispatched while paused.
+	time.Sleep(50 * time.Millisecond)
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("Expected no requests while paused, got %d", n)
+	}
+
+	s.Resume()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("Expected no error, got: %v", res.err)
+		}
+		if findDeadLink(res.deadLinks, ts.URL+"/dead") == nil {
+			t.Errorf("Expected dead link not found in: %v", res.deadLinks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Crawl did not finish after resuming")
+	}
+}
+
+func TestScraper_CancelWhilePaused(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>No links</body></html>`)
+	}))
+	defer ts.Close()
+
+	s := NewScraper(DefaultConfig())
+	s.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.Run(ctx, ts.URL)
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Paused crawl was not cancelled")
+	}
+}
+
+func TestStartScraper_RespectCanonical(t *testing.T) {
+	var mu sync.Mutex
+	hits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/a">a</a><a href="/b">b</a></body></html>`)
+		case "/a", "/b":
+			// Both URLs serve the same content under one canonical.
+			fmt.Fprintf(w, `<html><head><link rel="canonical" href="/article"></head>
+				<body><a href="%s-child">child</a></body></html>`, r.URL.Path)
+		default:
+			fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	crawl := func(respectCanonical bool) []string {
+		mu.Lock()
+		hits = hits[:0]
+		mu.Unlock()
+		cfg := DefaultConfig()
+		cfg.RespectCanonical = respectCanonical
+		if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return slices.Clone(hits)
+	}
+
+	got := crawl(false)
+	if !slices.Contains(got, "/a-child") || !slices.Contains(got, "/b-child") {
+		t.Errorf("Expected both children to be crawled, got: %v", got)
+	}
+
+	got = crawl(true)
+	if slices.Contains(got, "/a-child") == slices.Contains(got, "/b-child") {
+		t.Errorf("Expected exactly one duplicate's children to be crawled, got: %v", got)
+	}
+}
+
+func TestStartScraper_CrawlCanonicalAndAlternate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head>
+				<link rel="canonical" href="/home">
+				<link rel="alternate" type="application/rss+xml" href="/feed">
+			</head><body>Home</body></html>`)
+		case "/home":
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="/home"></head><body><a href="/about">About</a></body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<html><body>About</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	crawl := func(follow bool) []DeadLink {
+		cfg := DefaultConfig()
+		cfg.CrawlCanonicalAndAlternate = follow
+		result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if got := len(result.Pages); follow && got != 3 || !follow && got != 1 {
+			t.Errorf("Expected the canonical page and its links to be crawled only if followed, got %d pages", got)
+		}
+		if len(result.SelfLinks) != 0 {
+			t.Errorf("Expected a self-canonical not to count as a self-link, got: %v", result.SelfLinks)
+		}
+		return result.DeadLinks
+	}
+
+	if deadLinks := crawl(false); len(deadLinks) != 0 {
+		t.Errorf("Expected no dead links, got: %+v", deadLinks)
+	}
+	deadLinks := crawl(true)
+	if len(deadLinks) != 1 || findDeadLink(deadLinks, ts.URL+"/feed") == nil || deadLinks[0].Rel != "alternate" {
+		t.Errorf("Expected the missing alternate to be reported, got: %+v", deadLinks)
+	}
+}
+
+func TestScraper_ScaleDown(t *testing.T) {
+	const pages = 20
+	started := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		if r.URL.Path == "/" {
+			for i := range pages {
+				fmt.Fprintf(w, `<a href="/page%d">page</a>`, i)
+			}
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "-dead") {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `<a href="%s-dead">dead</a>`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	s := NewScraper(DefaultConfig())
+	done := make(chan []DeadLink)
+	go func() {
+		res, err := s.Run(context.Background(), ts.URL)
+		if err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+		done <- res.DeadLinks
+	}()
+
+	// Scale down once the crawl is under way.
+	<-started
+	s.Scale(1)
+	s.mu.Lock()
+	if size := s.pool.size(); size != 1 {
+		t.Errorf("Expected 1 worker after scaling, got %d", size)
+	}
+	s.mu.Unlock()
+
+	deadLinks := <-done
+	if len(deadLinks) != pages {
+		t.Errorf("Expected %d dead links, got %d: %v", pages, len(deadLinks), deadLinks)
+	}
+}
+
+func TestStartScraper_CaptureHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/unavailable">unavailable</a></body></html>`)
+		default:
+			w.Header().Set("Retry-After", "120")
+			w.Header().Set("Via", "1.1 cdn")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	deadLink := findDeadLink(deadLinks, ts.URL+"/unavailable")
+	if deadLink == nil {
+		t.Fatalf("Expected dead link not found in: %v", deadLinks)
+	}
+	if deadLink.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, deadLink.StatusCode)
+	}
+	if deadLink.Headers != nil {
+		t.Errorf("Expected no headers without CaptureHeaders, got: %v", deadLink.Headers)
+	}
+
+	cfg.CaptureHeaders = true
+	deadLinks, err = StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	deadLink = findDeadLink(deadLinks, ts.URL+"/unavailable")
+	if deadLink == nil {
+		t.Fatalf("Expected dead link not found in: %v", deadLinks)
+	}
+	if got := deadLink.Headers.Get("Retry-After"); got != "120" {
+		t.Errorf("Expected Retry-After header %q, got %q", "120", got)
+	}
+	if got := deadLink.Headers.Get("Via"); got != "1.1 cdn" {
+		t.Errorf("Expected Via header %q, got %q", "1.1 cdn", got)
+	}
+}
+
+func TestStartScraper_CaptureDeadBody(t *testing.T) {
+	const blockPage = "<html><body>Request blocked by firewall</body></html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/blocked">blocked</a></body></html>`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, blockPage)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		capture bool
+		limit   int64
+		want    string
+	}{
+		{"disabled", false, 0, ""},
+		{"default limit", true, 0, blockPage},
+		{"truncated", true, 12, blockPage[:12]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CaptureDeadBody = tt.capture
+			cfg.MaxCapturedBodyBytes = tt.limit
+			result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			deadLink := findDeadLink(result.DeadLinks, ts.URL+"/blocked")
+			if deadLink == nil {
+				t.Fatalf("Expected dead link not found in: %v", result.DeadLinks)
+			}
+			if deadLink.Body != tt.want {
+				t.Errorf("Expected body %q, got %q", tt.want, deadLink.Body)
+			}
+		})
+	}
+}
+
+func TestStartScraper_TreatWWWEqual(t *testing.T) {
+	var mu sync.Mutex
+	pageHosts := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			port := strings.Split(r.Host, ":")[1]
+			fmt.Fprintf(w, `<html><body><a href="http://example.test:%s/page">apex</a><a href="http://www.example.test:%s/page">www</a></body></html>`,
+				port, port)
+		case "/page":
+			mu.Lock()
+			pageHosts = append(pageHosts, r.Host)
+			mu.Unlock()
+			fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Both hostnames resolve to the test server.
+	seed := "http://example.test:" + strings.Split(ts.URL, ":")[2]
+	crawl := func(treatWWWEqual bool) []string {
+		mu.Lock()
+		pageHosts = pageHosts[:0]
+		mu.Unlock()
+		cfg := DefaultConfig()
+		cfg.Resolver = (&fakeDNS{}).resolver()
+		cfg.TreatWWWEqual = treatWWWEqual
+		if _, err := StartScraperWithConfig(seed, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return slices.Clone(pageHosts)
+	}
+
+	if got := crawl(false); len(got) != 2 {
+		t.Errorf("Expected both variants to be requested, got: %v", got)
+	}
+	if got := crawl(true); len(got) != 1 {
+		t.Errorf("Expected a single request for both variants, got: %v", got)
+	}
+}
+
+func TestStartScraper_CanonicalHost(t *testing.T) {
+	var mu sync.Mutex
+	hosts := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts[r.Host]++
+		mu.Unlock()
+		port := strings.Split(r.Host, ":")[1]
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="http://example.test:%s/a">a</a><a href="http://www.example.test:%s/b">b</a><a href="http://www.example.test:%s/">home</a></body></html>`,
+				port, port, port)
+		case "/a":
+			fmt.Fprintf(w, `<html><body><a href="http://example.test:%s/b">b</a></body></html>`, port)
+		default:
+			fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	// Both hostnames resolve to the test server.
+	port := strings.Split(ts.URL, ":")[2]
+	cfg := DefaultConfig()
+	cfg.Resolver = (&fakeDNS{}).resolver()
+	cfg.CanonicalHost = "www.example.test"
+	result, err := NewScraper(cfg).Run(context.Background(), "http://example.test:"+port+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if want := map[string]int{"www.example.test:" + port: 3}; !maps.Equal(hosts, want) {
+		t.Errorf("Expected each page to be requested once on the canonical host, got: %v", hosts)
+	}
+	for _, page := range result.Pages {
+		if !strings.HasPrefix(page.URL, "http://www.example.test:") {
+			t.Errorf("Expected pages on the canonical host, got: %s", page.URL)
+		}
+	}
+}
+
+func BenchmarkScrape_LargePages(b *testing.B) {
+	const pages = 50
+	// Each page is a large, deeply structured document without links.
+	var largePage strings.Builder
+	largePage.WriteString("<html><body>")
+	for range 5000 {
+		largePage.WriteString(`<div class="row"><span>Lorem ipsum dolor sit amet</span></div>`)
+	}
+	largePage.WriteString("</body></html>")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			for i := range pages {
+				fmt.Fprintf(w, `<a href="/page%d">page</a>`, i)
+			}
+			return
+		}
+		fmt.Fprint(w, largePage.String())
+	}))
+	defer ts.Close()
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	for _, maxParse := range []int{0, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("MaxParseConcurrency=%d", maxParse), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.Workers = 4 * runtime.GOMAXPROCS(0)
+			cfg.MaxParseConcurrency = maxParse
+			for range b.N {
+				if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+					b.Fatalf("Expected no error, got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStartScraper_ContentTypes(t *testing.T) {
+	var mu sync.Mutex
+	hits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/doc.pdf">pdf</a><a href="/notes.txt">notes</a><a href="/page">page</a><a href="/untyped">untyped</a></body></html>`)
+		case "/doc.pdf":
+			// Bodies of checked types are never parsed, even if they look like HTML.
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprintf(w, `<a href="/from-pdf">link</a>`)
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintf(w, `<a href="/from-text">link</a>`)
+		case "/page":
+			fmt.Fprintf(w, `<html><body><a href="/from-page">link</a></body></html>`)
+		case "/untyped":
+			// Keeps the server from sniffing a Content-Type.
+			w.Header()["Content-Type"] = nil
+			fmt.Fprintf(w, `<a href="/from-untyped">link</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	crawl := func(cfg Config) []string {
+		mu.Lock()
+		hits = hits[:0]
+		mu.Unlock()
+		if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return slices.Clone(hits)
+	}
+
+	// By default only HTML is crawled, but every link is checked.
+	got := crawl(DefaultConfig())
+	for _, path := range []string{"/doc.pdf", "/notes.txt", "/from-page", "/from-untyped"} {
+		if !slices.Contains(got, path) {
+			t.Errorf("Expected %s to be requested, got: %v", path, got)
+		}
+	}
+	if slices.Contains(got, "/from-pdf") || slices.Contains(got, "/from-text") {
+		t.Errorf("Expected non-HTML bodies not to be crawled, got: %v", got)
+	}
+
+	// A wildcard crawls all text types, except those explicitly only checked.
+	cfg := DefaultConfig()
+	cfg.CrawlContentTypes = []string{"text/*", "application/pdf"}
+	cfg.CheckContentTypes = []string{"application/pdf"}
+	got = crawl(cfg)
+	if !slices.Contains(got, "/from-text") || !slices.Contains(got, "/from-page") {
+		t.Errorf("Expected text bodies to be crawled, got: %v", got)
+	}
+	if slices.Contains(got, "/from-pdf") {
+		t.Errorf("Expected checked types not to be crawled, got: %v", got)
+	}
+}
+
+func TestStartScraper_Strategy(t *testing.T) {
+	site := map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/a1", "/a2"},
+		"/b": {"/b1"},
+	}
+	var mu sync.Mutex
+	visits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visits = append(visits, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, "<html><body>")
+		for _, href := range site[r.URL.Path] {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, href)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		strategy Strategy
+		want     []string
+	}{
+		{StrategyBFS, []string{"/", "/a", "/b", "/a1", "/a2", "/b1"}},
+		{StrategyDFS, []string{"/", "/a", "/a1", "/a2", "/b", "/b1"}},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		visits = visits[:0]
+		mu.Unlock()
+
+		cfg := DefaultConfig()
+		cfg.Workers = 1
+		cfg.Strategy = tt.strategy
+		if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !slices.Equal(visits, tt.want) {
+			t.Errorf("Strategy %d: expected visit order %v, got %v", tt.strategy, tt.want, visits)
+		}
+	}
+}
+
+func TestStartScraper_StripUserInfo(t *testing.T) {
+	var mu sync.Mutex
+	authorized := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok && user == "user" && password == "secret" {
+			mu.Lock()
+			authorized = append(authorized, r.URL.Path)
+			mu.Unlock()
+		}
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	seed := strings.Replace(ts.URL, "http://", "http://user:secret@", 1)
+	for _, strip := range []bool{true, false} {
+		mu.Lock()
+		authorized = authorized[:0]
+		mu.Unlock()
+		logs.Reset()
+
+		cfg := DefaultConfig()
+		cfg.StripUserInfo = strip
+		result, err := NewScraper(cfg).Run(context.Background(), seed)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if result.Seed != ts.URL {
+			t.Errorf("Expected sanitized seed %q, got %q", ts.URL, result.Seed)
+		}
+
+		deadLinks := result.DeadLinks
+		deadLink := findDeadLink(deadLinks, ts.URL+"/dead")
+		if deadLink == nil {
+			t.Fatalf("Expected sanitized dead link not found in: %v", deadLinks)
+		}
+		if deadLink.Referrer != ts.URL {
+			t.Errorf("Expected sanitized referrer %q, got %q", ts.URL, deadLink.Referrer)
+		}
+		if strings.Contains(logs.String(), "secret") || strings.Contains(logs.String(), "user:") {
+			t.Errorf("Expected credentials to be kept out of the logs, got:\n%s", logs.String())
+		}
+
+		// Credentials are only sent when they are preserved.
+		if got := len(authorized) > 0; got == strip {
+			t.Errorf("StripUserInfo=%v: unexpected authorized requests: %v", strip, authorized)
+		}
+	}
+}
+
+func TestStartScraper_CheckResourceHints(t *testing.T) {
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><head>
+				<link rel="preload" href="/missing.woff2" as="font">
+				<link rel="modulepreload" href="/app.js">
+				<link rel="prefetch" href="/missing-next">
+				<link rel="dns-prefetch" href="/dns-prefetch">
+				<link rel="preconnect" href="/preconnect">
+				<link rel="stylesheet" href="/style.css">
+			</head><body>Home</body></html>`)
+		case "/app.js":
+			w.Header().Set("Content-Type", "text/javascript")
+			fmt.Fprint(w, `console.log("hi")`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	for _, hints := range []bool{false, true} {
+		mu.Lock()
+		requested = requested[:0]
+		mu.Unlock()
+
+		cfg := DefaultConfig()
+		cfg.CheckResourceHints = hints
+		deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if !hints {
+			if len(deadLinks) != 0 {
+				t.Errorf("Expected resource hints to be ignored by default, got: %v", deadLinks)
+			}
+			continue
+		}
+		for path, rel := range map[string]string{"/missing.woff2": "preload", "/missing-next": "prefetch"} {
+			deadLink := findDeadLink(deadLinks, ts.URL+path)
+			if deadLink == nil {
+				t.Errorf("Expected %s hint %s to be reported, got: %v", rel, path, deadLinks)
+				continue
+			}
+			if deadLink.Rel != rel {
+				t.Errorf("Expected rel %q for %s, got %q", rel, path, deadLink.Rel)
+			}
+		}
+		if len(deadLinks) != 2 {
+			t.Errorf("Expected 2 dead links, got: %v", deadLinks)
+		}
+		mu.Lock()
+		if !slices.Contains(requested, "/app.js") {
+			t.Errorf("Expected modulepreload hint to be checked, got requests: %v", requested)
+		}
+		for _, path := range []string{"/dns-prefetch", "/preconnect", "/style.css"} {
+			if slices.Contains(requested, path) {
+				t.Errorf("Expected %s not to be requested, got requests: %v", path, requested)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestStartScraper_IsDead(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/missing">Missing</a><a href="/error">Error</a><a href="/empty">Empty</a></body></html>`)
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		isDead func(int) bool
+		want   []string
+	}{
+		{"default", nil, []string{"/error", "/missing"}},
+		{"server errors only", func(code int) bool { return code >= 500 }, []string{"/error"}},
+		{"no content too", func(code int) bool { return code == http.StatusNoContent || code >= 400 }, []string{"/empty", "/error", "/missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.IsDead = tt.isDead
+			deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			got := make([]string, 0, len(deadLinks))
+			for _, deadLink := range deadLinks {
+				got = append(got, strings.TrimPrefix(deadLink.URL, ts.URL))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected dead links %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStartScraper_ExtraAttributesAndJSONLD(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><head>
+				<script type="application/ld+json">
+				{"@context": "https://schema.org", "@type": "Organization",
+				 "url": "/jsonld-url", "logo": "/logo.png",
+				 "sameAs": ["/jsonld-same-as"]}
+				</script>
+			</head><body>
+				<button data-href="/data-href">Go</button>
+				<div data-url="/data-url">Card</div>
+			</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected extra links to be ignored by default, got: %v", deadLinks)
+	}
+
+	cfg.ExtraAttributes = []string{"data-href"}
+	cfg.ParseJSONLD = true
+	deadLinks, err = StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	got := make([]string, 0, len(deadLinks))
+	for _, deadLink := range deadLinks {
+		got = append(got, strings.TrimPrefix(deadLink.URL, ts.URL))
+	}
+	slices.Sort(got)
+	if want := []string{"/data-href", "/jsonld-same-as", "/jsonld-url"}; !slices.Equal(got, want) {
+		t.Errorf("Expected dead links %v, got %v", want, got)
+	}
+	if deadLink := findDeadLink(deadLinks, ts.URL+"/data-href"); deadLink != nil && deadLink.AnchorText != "Go" {
+		t.Errorf("Expected anchor text %q, got %q", "Go", deadLink.AnchorText)
+	}
+}
+
+func TestStartScraper_RewriteURL(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/staging/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	staging, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.RewriteURL = func(u *url.URL) *url.URL {
+		u.Host = staging.Host
+		u.Path = "/staging" + u.Path
+		return u
+	}
+	deadLinks, err := StartScraperWithConfig("http://prod.example.com/", cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, "http://prod.example.com/dead") == nil {
+		t.Errorf("Expected the original URL to be reported, got: %v", deadLinks)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"/staging/", "/staging/dead"}; !slices.Equal(fetched, want) {
+		t.Errorf("Expected rewritten URLs %v to be fetched, got %v", want, fetched)
+	}
+}
+
+func TestStartScraper_SkipExtensions(t *testing.T) {
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<a href="/release.ZIP">Download</a>
+				<a href="/backup.tar.gz">Backup</a>
+				<a href="/missing.html">Missing</a>
+			</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.SkipExtensions = []string{".zip", "tar.gz"}
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 1 || findDeadLink(deadLinks, ts.URL+"/missing.html") == nil {
+		t.Errorf("Expected only the HTML link to be reported, got: %v", deadLinks)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(requested, "/release.ZIP") || slices.Contains(requested, "/backup.tar.gz") {
+		t.Errorf("Expected skipped extensions not to be fetched, got requests: %v", requested)
+	}
+}
+
+func TestRun_DeadEndPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/contact">Contact</a><a href="/logo.png">Logo</a></body></html>`)
+		case "/contact":
+			fmt.Fprintf(w, `<html><body><a href="mailto:team@example.com">Mail us</a></body></html>`)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	result, err := NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if want := []string{ts.URL + "/contact"}; !slices.Equal(result.DeadEndPages, want) {
+		t.Errorf("Expected dead-end pages %v, got %v", want, result.DeadEndPages)
+	}
+}
+
+func TestStartScraper_WorkerStartStagger(t *testing.T) {
+	var mu sync.Mutex
+	var requestedAt []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><body><a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a></body></html>`)
+			return
+		}
+		mu.Lock()
+		requestedAt = append(requestedAt, time.Now())
+		mu.Unlock()
+		// Keep every worker busy, so that each link goes to a new one.
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	for _, stagger := range []time.Duration{0, 50 * time.Millisecond} {
+		requestedAt = requestedAt[:0]
+		cfg := DefaultConfig()
+		cfg.Workers = 4
+		cfg.WorkerStartStagger = stagger
+		if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		if len(requestedAt) != 4 {
+			t.Fatalf("Expected 4 requests, got %d", len(requestedAt))
+		}
+		spread := requestedAt[3].Sub(requestedAt[0])
+		if stagger == 0 && spread >= 50*time.Millisecond {
+			t.Errorf("Expected requests to start together without stagger, spread over %s", spread)
+		}
+		// The four workers start 0, 1, 2 and 3 staggers in.
+		if stagger > 0 && spread < 2*stagger {
+			t.Errorf("Expected requests spread over at least %s, got %s", 2*stagger, spread)
+		}
+	}
+}
+
+func TestStartScraper_MaxInFlight(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		if r.URL.Path != "/" {
+			time.Sleep(30 * time.Millisecond)
+			http.NotFound(w, r)
+			return
+		}
+		var sb strings.Builder
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 10
+	cfg.MaxInFlight = 2
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 10 {
+		t.Errorf("Expected 10 dead links, got %d", len(deadLinks))
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got a peak of %d", got)
+	}
+}
+
+func TestStartScraper_IsDeadResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/status">Status</a><a href="/about">About</a></body></html>`)
+		case "/status":
+			fmt.Fprintf(w, `<html><body>Under maintenance</body></html>`)
+		case "/about":
+			fmt.Fprintf(w, `<html><body>%s</body></html>`, strings.Repeat("About us. ", 20))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var longest int
+	cfg := DefaultConfig()
+	cfg.MaxBodyBytes = 100
+	cfg.IsDeadResponse = func(resp *http.Response, body []byte) (bool, error) {
+		mu.Lock()
+		longest = max(longest, len(body))
+		mu.Unlock()
+		if resp.Request.URL.Path == "/about" {
+			return false, errors.New("ignored")
+		}
+		return bytes.Contains(body, []byte("maintenance")), nil
+	}
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 1 {
+		t.Fatalf("Expected only the maintenance page to be dead, got: %v", deadLinks)
+	}
+	deadLink := deadLinks[0]
+	if deadLink.URL != ts.URL+"/status" || deadLink.Kind != KindDeadResponse || deadLink.StatusCode != http.StatusOK {
+		t.Errorf("Expected %s to be dead by response with status 200, got: %+v", ts.URL+"/status", deadLink)
+	}
+	if longest != 100 {
+		t.Errorf("Expected bodies to be limited to 100 bytes, got %d", longest)
+	}
+}
+
+func TestStartScraper_TwoPhase(t *testing.T) {
+	// Requests to both servers are logged in order.
+	var mu sync.Mutex
+	var log []string
+	record := func(r *http.Request, server string) {
+		mu.Lock()
+		log = append(log, server+r.URL.Path)
+		mu.Unlock()
+	}
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r, "external")
+		http.NotFound(w, r)
+	}))
+	defer external.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r, "internal")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="%s/x">x</a><a href="/a">a</a></body></html>`, external.URL)
+		case "/a":
+			fmt.Fprintf(w, `<html><body><a href="%s/y">y</a><a href="/b">b</a></body></html>`, external.URL)
+		case "/b":
+			fmt.Fprintf(w, `<html><body><a href="%s/z">z</a><a href="/missing">missing</a></body></html>`, external.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.TwoPhase = true
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 4 {
+		t.Errorf("Expected 4 dead links, got: %v", deadLinks)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(log) != 7 {
+		t.Fatalf("Expected 7 requests, got: %v", log)
+	}
+	// Internal pages are all discovered before any external link is checked.
+	for i, request := range log {
+		if internal := strings.HasPrefix(request, "internal"); internal != (i < 4) {
+			t.Errorf("Expected internal requests before external ones, got: %v", log)
+			break
+		}
+	}
+}
+
+func TestStartScraper_NormalizeTrailingSlash(t *testing.T) {
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><body>
+				<a href="/docs">Docs</a>
+				<a href="/docs/">Docs</a>
+				<a href="/guide/">Guide</a>
+				<a href="/style.css">Style</a>
+			</body></html>`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		mode TrailingSlash
+		want []string
+	}{
+		{TrailingSlashKeep, []string{"/", "/docs", "/docs/", "/guide/", "/style.css"}},
+		{TrailingSlashAdd, []string{"/", "/docs/", "/guide/", "/style.css"}},
+		{TrailingSlashStrip, []string{"/", "/docs", "/guide", "/style.css"}},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		requested = requested[:0]
+		mu.Unlock()
+
+		cfg := DefaultConfig()
+		cfg.NormalizeTrailingSlash = tt.mode
+		if _, err := StartScraperWithConfig(ts.URL+"/", cfg); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		mu.Lock()
+		got := slices.Sorted(slices.Values(requested))
+		mu.Unlock()
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Mode %d: expected requests %v, got %v", tt.mode, tt.want, got)
+		}
+	}
+}
+
+func TestStartScraper_ExternalRedirects(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>External</body></html>")
+	}))
+	defer external.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/out">Out</a><a href="/in">In</a></body></html>`)
+		case "/out":
+			http.Redirect(w, r, external.URL+"/landing", http.StatusMovedPermanently)
+		case "/in":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	result, err := NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []ExternalRedirect{{
+		URL:        ts.URL + "/out",
+		Referrer:   ts.URL,
+		FinalURL:   external.URL + "/landing",
+		OriginHost: strings.TrimPrefix(ts.URL, "http://"),
+		FinalHost:  strings.TrimPrefix(external.URL, "http://"),
+	}}
+	if !slices.Equal(result.ExternalRedirects, want) {
+		t.Errorf("Expected external redirects %+v, got %+v", want, result.ExternalRedirects)
+	}
+}
+
+func TestStartScraper_NoFollowRedirects(t *testing.T) {
+	var targetRequested atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/moved">Moved</a></body></html>`)
+		case "/moved":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/target":
+			targetRequested.Store(true)
+			fmt.Fprint(w, "<html><body>Target</body></html>")
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.FollowRedirects = false
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []Redirect{{
+		URL:        ts.URL + "/moved",
+		Referrer:   ts.URL,
+		StatusCode: http.StatusFound,
+		Location:   ts.URL + "/target",
+	}}
+	if !slices.Equal(result.Redirects, want) {
+		t.Errorf("Expected redirects %+v, got %+v", want, result.Redirects)
+	}
+	if targetRequested.Load() {
+		t.Error("Expected the redirect target not to be requested")
+	}
+	if len(result.DeadLinks) != 0 {
+		t.Errorf("Expected no dead links, got: %+v", result.DeadLinks)
+	}
+}
+
+func TestStartScraper_CountLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><link rel="preload" href="/font.woff2"></head><body>
+				<a href="/about">About</a>
+				<a href="/contact">Contact</a>
+				<a href="https://example.invalid/">External</a>
+				<img srcset="/small.png 1x, /large.png 2x">
+			</body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<html><body>No links</body></html>`)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Mode = ModeInternalOnly
+	cfg.CheckResourceHints = true
+	cfg.CountLinks = true
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := map[string]LinkCounts{
+		ts.URL:            {Internal: 2, External: 1, Assets: 3},
+		ts.URL + "/about": {},
+	}
+	if !maps.Equal(result.LinkCounts, want) {
+		t.Errorf("Expected link counts %v, got %v", want, result.LinkCounts)
+	}
+}
+
+func TestExtractLinks_MaxHTMLDepth(t *testing.T) {
+	const nesting = 3000
+	doc := `<html><body><a href="/shallow">Shallow</a>` +
+		strings.Repeat("<div>", nesting) + `<a href="/deep">Deep</a>` + strings.Repeat("</div>", nesting) +
+		`</body></html>`
+	base, _ := url.Parse("http://example.com/")
+
+	cfg := DefaultConfig()
+	page, err := extractLinks(strings.NewReader(doc), base, &cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var got []string
+	for _, l := range page.links {
+		got = append(got, l.url.Path)
+	}
+	if want := []string{"/shallow"}; !slices.Equal(got, want) {
+		t.Errorf("Expected links past the depth limit to be ignored, got: %v", got)
+	}
+	if !page.tooDeep {
+		t.Errorf("Expected the page to be flagged as too deep")
+	}
+
+	cfg.MaxHTMLDepth = nesting + 10
+	if page, err = extractLinks(strings.NewReader(doc), base, &cfg, slog.Default()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(page.links) != 2 || page.tooDeep {
+		t.Errorf("Expected a higher limit to find the deep link, got: %v", page.links)
+	}
+}
+
+func TestExtractLinks_IgnoreInertContent(t *testing.T) {
+	doc := `<html><body>
+		<a href="/real">Real</a>
+		<template><li><a href="/{{url}}">{{title}}</a></li></template>
+	</body></html>`
+	base, _ := url.Parse("http://example.com/")
+
+	cfg := DefaultConfig()
+	page, err := extractLinks(strings.NewReader(doc), base, &cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(page.links) != 2 {
+		t.Errorf("Expected the template link to be extracted by default, got: %v", page.links)
+	}
+
+	cfg.IgnoreInertContent = true
+	if page, err = extractLinks(strings.NewReader(doc), base, &cfg, slog.Default()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var got []string
+	for _, l := range page.links {
+		got = append(got, l.url.Path)
+	}
+	if want := []string{"/real"}; !slices.Equal(got, want) {
+		t.Errorf("Expected links within inert content to be ignored, got: %v", got)
+	}
+}
+
+func TestStartScraper_FlagEmptyPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/empty">Empty</a><a href="/blank">Blank</a><a href="/short">Short</a></body></html>`)
+		case "/blank":
+			fmt.Fprint(w, "  \n\t\n")
+		case "/short":
+			fmt.Fprint(w, "<html></html>")
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.FlagEmptyPages = true
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	slices.Sort(result.EmptyPages)
+	if want := []string{ts.URL + "/blank", ts.URL + "/empty"}; !slices.Equal(result.EmptyPages, want) {
+		t.Errorf("Expected empty pages %v, got %v", want, result.EmptyPages)
+	}
+
+	cfg.MinBodyBytes = 20
+	if result, err = NewScraper(cfg).Run(context.Background(), ts.URL); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.EmptyPages) != 3 {
+		t.Errorf("Expected pages shorter than MinBodyBytes to be flagged, got %v", result.EmptyPages)
+	}
+}
+
+func TestExtractLinks_SelfReferences(t *testing.T) {
+	doc := `<html><body>
+		<a href="#">Top</a>
+		<a href="">Reload</a>
+		<a href=" #section ">Section</a>
+		<a href="/next#part">Next</a>
+	</body></html>`
+	base, _ := url.Parse("http://example.com/")
+
+	cfg := DefaultConfig()
+	page, err := extractLinks(strings.NewReader(doc), base, &cfg, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var got []string
+	for _, l := range page.links {
+		got = append(got, l.url.String())
+	}
+	if want := []string{"http://example.com/next"}; !slices.Equal(got, want) {
+		t.Errorf("Expected empty and fragment-only hrefs to be skipped, got: %v", got)
+	}
+}
+
+func TestStartScraper_MaxURLLength(t *testing.T) {
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	long := "/" + strings.Repeat("a/", 1500)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><body><a href="%s">Long</a><a href="/short">Short</a></body></html>`, long)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	result, err := NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if slices.Contains(requested, long) {
+		t.Error("Expected the overly long URL not to be requested")
+	}
+	if !slices.Equal(result.Skipped, []string{ts.URL + long}) {
+		t.Errorf("Expected the overly long URL to be skipped, got: %v", result.Skipped)
+	}
+	if findDeadLink(result.DeadLinks, ts.URL+"/short") == nil {
+		t.Errorf("Expected other links to be checked, got: %v", result.DeadLinks)
+	}
+
+	// A negative limit lifts it.
+	cfg := DefaultConfig()
+	cfg.MaxURLLength = -1
+	if result, err = NewScraper(cfg).Run(context.Background(), ts.URL); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(result.DeadLinks, ts.URL+long) == nil {
+		t.Errorf("Expected the long URL to be checked without a limit, got: %v", result.Skipped)
+	}
+}
+
+func TestStartScraper_ChunkedBody(t *testing.T) {
+	// The page streams without a Content-Length: a live link and a dead one
+	// within the limit, then a dead link past it, then padding forever.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			flusher := w.(http.Flusher)
+			fmt.Fprint(w, `<html><body><a href="/ok">OK</a><a href="/near">Near</a>`)
+			flusher.Flush()
+			padding := strings.Repeat(" ", 1024)
+			for i := 0; r.Context().Err() == nil; i++ {
+				if i == 4 {
+					fmt.Fprint(w, `<a href="/far">Far</a>`)
+				}
+				if _, err := fmt.Fprint(w, padding); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		case "/ok":
+			fmt.Fprint(w, `<html><body>OK</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxBodyBytes = 2048
+	done := make(chan struct{})
+	var deadLinks []DeadLink
+	var err error
+	go func() {
+		defer close(done)
+		deadLinks, err = StartScraperWithConfig(ts.URL, cfg)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the crawl to stop reading the endless body")
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 1 || findDeadLink(deadLinks, ts.URL+"/near") == nil {
+		t.Errorf("Expected only the link within MaxBodyBytes to be checked, got: %v", deadLinks)
+	}
+}
+
+func TestStartScraper_StalledChunkedBody(t *testing.T) {
+	// The page sends its start without a Content-Length, then stalls.
+	release := make(chan struct{})
+	defer close(release)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/near">Near</a>`)
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Timeout = 100 * time.Millisecond
+	cfg.ResponseHeaderTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the stalled body to be cut off by Timeout, took %s", elapsed)
+	}
+}
+
+func TestScraper_Label(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a><a href="http://[::1">invalid</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	cfg := DefaultConfig()
+	cfg.Label = "docs-nightly"
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Label != "docs-nightly" {
+		t.Errorf("Expected the label in the result, got: %q", result.Label)
+	}
+	var saved bytes.Buffer
+	if err := result.Save(&saved); err != nil || !strings.Contains(saved.String(), `"label":"docs-nightly"`) {
+		t.Errorf("Expected the label in the saved result, got: %s, %v", saved.String(), err)
+	}
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON log records, got: %q", line)
+		}
+		msg, _ := record["msg"].(string)
+		if strings.HasPrefix(msg, "Found deadlink: "+ts.URL+"/dead") || strings.HasPrefix(msg, "Failed to clean URL") || strings.HasPrefix(msg, "Done scraping") {
+			if record["label"] != "docs-nightly" {
+				t.Errorf("Expected the label in %q, got: %v", msg, record)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected crawl logs, got:\n%s", logs.String())
+	}
+}
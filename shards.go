@@ -0,0 +1,106 @@
+package main
+
+import "time"
+
+// hostShards holds, in one queue per host, the jobs whose host is still
+// waiting out its request delay, for Config.StealWork. The link handler
+// dispatches jobs for other hosts in the meantime, so that a rate-limited
+// host does not keep workers asleep.
+type hostShards struct {
+	throttle *hostThrottle
+	queues   map[string][]*job
+	// hosts lists the hosts with queued jobs, in the order they were first
+	// queued.
+	hosts []string
+	n     int
+}
+
+func newHostShards(throttle *hostThrottle) *hostShards {
+	return &hostShards{throttle: throttle, queues: make(map[string][]*job)}
+}
+
+// blocked reports whether jobs for host must wait at now.
+func (s *hostShards) blocked(host string, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	return len(s.queues[host]) > 0 || s.throttle.readyAt(host).After(now)
+}
+
+// park queues j until its host is ready.
+func (s *hostShards) park(j *job) {
+	host := j.url.Host
+	if len(s.queues[host]) == 0 {
+		s.hosts = append(s.hosts, host)
+	}
+	s.queues[host] = append(s.queues[host], j)
+	s.n++
+}
+
+// next returns the first queued job of the first host ready at now, or nil.
+func (s *hostShards) next(now time.Time) *job {
+	if s == nil {
+		return nil
+	}
+	for _, host := range s.hosts {
+		if !s.throttle.readyAt(host).After(now) {
+			return s.queues[host][0]
+		}
+	}
+	return nil
+}
+
+// remove removes j, which next returned.
+func (s *hostShards) remove(j *job) {
+	host := j.url.Host
+	queue := s.queues[host][1:]
+	s.n--
+	if len(queue) > 0 {
+		s.queues[host] = queue
+		return
+	}
+	delete(s.queues, host)
+	for i, h := range s.hosts {
+		if h == host {
+			s.hosts = append(s.hosts[:i], s.hosts[i+1:]...)
+			break
+		}
+	}
+}
+
+// wake returns when the next queued host is ready. It reports false if no
+// job is queued.
+func (s *hostShards) wake() (time.Time, bool) {
+	if s == nil || s.n == 0 {
+		return time.Time{}, false
+	}
+	var earliest time.Time
+	for i, host := range s.hosts {
+		if ready := s.throttle.readyAt(host); i == 0 || ready.Before(earliest) {
+			earliest = ready
+		}
+	}
+	return earliest, true
+}
+
+// drain removes and returns all the queued jobs.
+func (s *hostShards) drain() []*job {
+	if s == nil {
+		return nil
+	}
+	var jobs []*job
+	for _, host := range s.hosts {
+		jobs = append(jobs, s.queues[host]...)
+	}
+	clear(s.queues)
+	s.hosts = nil
+	s.n = 0
+	return jobs
+}
+
+func (s *hostShards) len() int {
+	if s == nil {
+		return 0
+	}
+	return s.n
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartScraper_StealWork(t *testing.T) {
+	const crawlDelay = 300 * time.Millisecond
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Host+r.URL.Path)
+	}
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		record(r)
+		fmt.Fprint(w, "<html><body>Fast</body></html>")
+	}))
+	defer fast.Close()
+	var links strings.Builder
+	for i := range 2 {
+		fmt.Fprintf(&links, `<a href="/slow%d">Slow</a>`, i)
+	}
+	for i := range 10 {
+		fmt.Fprintf(&links, `<a href="%s/fast%d">Fast</a>`, fast.URL, i)
+	}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nCrawl-delay: %g\n", crawlDelay.Seconds())
+			return
+		}
+		record(r)
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, "<html><body>%s</body></html>", links.String())
+			return
+		}
+		fmt.Fprint(w, "<html><body>Slow</body></html>")
+	}))
+	defer slow.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 2
+	cfg.RespectRobots = true
+	cfg.StealWork = true
+	deadLinks, err := StartScraperWithConfig(slow.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected no dead links, got: %+v", deadLinks)
+	}
+
+	if len(requests) != 13 {
+		t.Fatalf("Expected 13 requests, got: %v", requests)
+	}
+	// The fast host is crawled while the slow one waits out its delay, so
+	// it is done before the slow host's second request.
+	slowHost := strings.TrimPrefix(slow.URL, "http://")
+	for i, request := range requests[:11] {
+		if i > 0 && strings.HasPrefix(request, slowHost) {
+			t.Errorf("Expected the fast host to be crawled before %s, got requests: %v", request, requests)
+		}
+	}
+}
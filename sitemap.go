@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// maxSitemapIndexDepth bounds how deeply sitemap indexes are followed.
+const maxSitemapIndexDepth = 3
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// lastModifiedLayouts are the W3C datetime formats allowed in <lastmod>.
+var lastModifiedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// lastModified parses the entry's <lastmod>. It reports false if it is
+// missing or malformed.
+func (u sitemapURL) lastModified() (time.Time, bool) {
+	for _, layout := range lastModifiedLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(u.LastMod)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sitemapIndex lists child sitemaps, and is only ever read.
+type sitemapIndex struct {
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// fetchSitemap returns the entries of the sitemap at loc, following
+// sitemap indexes.
+func fetchSitemap(ctx context.Context, client *http.Client, cfg *Config, loc string) ([]sitemapURL, error) {
+	return fetchSitemapDepth(ctx, client, cfg, loc, 0)
+}
+
+func fetchSitemapDepth(ctx context.Context, client *http.Client, cfg *Config, loc string, depth int) ([]sitemapURL, error) {
+	body, err := getSitemap(ctx, client, cfg, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var urlset sitemapURLSet
+	if err := xml.Unmarshal(body, &urlset); err == nil {
+		return urlset.URLs, nil
+	}
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("parsing sitemap %s: %w", loc, err)
+	}
+	if depth >= maxSitemapIndexDepth {
+		return nil, fmt.Errorf("sitemap index %s nested too deeply", loc)
+	}
+
+	entries := make([]sitemapURL, 0)
+	for _, child := range index.Sitemaps {
+		childEntries, err := fetchSitemapDepth(ctx, client, cfg, child.Loc, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, childEntries...)
+	}
+	return entries, nil
+}
+
+func getSitemap(ctx context.Context, client *http.Client, cfg *Config, loc string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching sitemap %s: status %s", loc, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// WriteSitemap writes a sitemap.xml listing the live pages of result, sorted
+// by URL. Dead links and non-HTML resources are never part of Pages.
+func WriteSitemap(w io.Writer, result Result) error {
+	pages := slices.SortedFunc(slices.Values(result.Pages), func(a, b Page) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+
+	urlset := sitemapURLSet{Xmlns: sitemapNamespace}
+	for _, page := range pages {
+		entry := sitemapURL{Loc: page.URL}
+		if !page.LastModified.IsZero() {
+			entry.LastMod = page.LastModified.UTC().Format(time.RFC3339)
+		}
+		urlset.URLs = append(urlset.URLs, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(urlset); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteSitemap(t *testing.T) {
+	lastModified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/about">about</a><a href="/file.pdf">pdf</a><a href="/dead">dead</a></body></html>`)
+		case "/about":
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+			fmt.Fprintf(w, `<html><body>About</body></html>`)
+		case "/file.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprintf(w, "%%PDF-1.4")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	result, err := NewScraper(DefaultConfig()).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSitemap(&buf, result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var urlset sitemapURLSet
+	if err := xml.Unmarshal(buf.Bytes(), &urlset); err != nil {
+		t.Fatalf("Sitemap is not valid XML: %v\n%s", err, buf.String())
+	}
+	if urlset.XMLName.Space != sitemapNamespace {
+		t.Errorf("Expected namespace %q, got %q", sitemapNamespace, urlset.XMLName.Space)
+	}
+
+	// Only the HTML pages are listed, in order, and without the dead link.
+	want := []sitemapURL{
+		{Loc: ts.URL},
+		{Loc: ts.URL + "/about", LastMod: "2025-01-02T03:04:05Z"},
+	}
+	if len(urlset.URLs) != len(want) {
+		t.Fatalf("Expected %d URLs, got: %+v", len(want), urlset.URLs)
+	}
+	for i := range want {
+		if urlset.URLs[i] != want[i] {
+			t.Errorf("URL %d: expected %+v, got %+v", i, want[i], urlset.URLs[i])
+		}
+	}
+}
+
+func TestRun_OrphanPages(t *testing.T) {
+	var mu sync.Mutex
+	hits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/linked">linked</a></body></html>`)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/sitemap.xml</loc></sitemap>
+</sitemapindex>`, base)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%s/</loc></url>
+  <url><loc>%s/linked</loc></url>
+  <url><loc>%s/orphan</loc></url>
+</urlset>`, base, base, base)
+		default:
+			fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Sitemap = ts.URL + "/sitemap_index.xml"
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	want := []string{ts.URL + "/orphan"}
+	if !slices.Equal(result.OrphanPages, want) {
+		t.Errorf("Expected orphan pages %v, got %v", want, result.OrphanPages)
+	}
+	// Orphans are still checked.
+	if !slices.Contains(hits, "/orphan") {
+		t.Errorf("Expected the orphan page to be fetched, got: %v", hits)
+	}
+}
+
+func TestRun_Since(t *testing.T) {
+	var mu sync.Mutex
+	hits := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>Home</body></html>`)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/old</loc><lastmod>2024-12-31</lastmod></url>
+  <url><loc>%[1]s/new</loc><lastmod>2025-03-01T10:00:00+00:00</lastmod></url>
+  <url><loc>%[1]s/undated</loc></url>
+</urlset>`, base)
+		default:
+			fmt.Fprintf(w, `<html><body>No further links</body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Sitemap = ts.URL + "/sitemap.xml"
+	cfg.Since = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(hits, "/old") {
+		t.Errorf("Expected the entry older than Since not to be visited, got: %v", hits)
+	}
+	if !slices.Contains(hits, "/new") || !slices.Contains(hits, "/undated") {
+		t.Errorf("Expected newer and undated entries to be visited, got: %v", hits)
+	}
+	if want := []string{ts.URL + "/new", ts.URL + "/undated"}; !slices.Equal(result.OrphanPages, want) {
+		t.Errorf("Expected orphan pages %v, got %v", want, result.OrphanPages)
+	}
+}
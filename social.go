@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// socialMetaProperties are the Open Graph and Twitter card properties whose
+// URLs are checked, for Config.CheckSocialMeta.
+var socialMetaProperties = map[string]bool{
+	"og:image":            true,
+	"og:image:url":        true,
+	"og:image:secure_url": true,
+	"og:url":              true,
+	"twitter:image":       true,
+	"twitter:image:src":   true,
+}
+
+// SocialMetaIssue describes a dead URL of a page's social preview metadata.
+type SocialMetaIssue struct {
+	// Page is the page the property was first found on.
+	Page string `json:"page"`
+	// Property is the <meta> property or name, e.g. "og:image".
+	Property   string    `json:"property"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Kind       ErrorKind `json:"kind"`
+}
+
+// socialMeta returns the property and URL of n if it is a <meta> tag of
+// socialMetaProperties, or "" if it is not. Open Graph uses the property
+// attribute and Twitter cards the name one, but both are seen either way.
+func socialMeta(n *html.Node) (property, href string) {
+	if n.Type != html.ElementNode || n.Data != "meta" {
+		return "", ""
+	}
+	property = strings.ToLower(attrValue(n, "property"))
+	if !socialMetaProperties[property] {
+		property = strings.ToLower(attrValue(n, "name"))
+	}
+	if !socialMetaProperties[property] {
+		return "", ""
+	}
+	return property, strings.TrimSpace(attrValue(n, "content"))
+}
+
+// socialMetaIssues returns the dead links found in social preview
+// metadata.
+func socialMetaIssues(deadLinks []DeadLink) []SocialMetaIssue {
+	var issues []SocialMetaIssue
+	for _, deadLink := range deadLinks {
+		if socialMetaProperties[deadLink.Rel] {
+			issues = append(issues, SocialMetaIssue{
+				Page:       deadLink.Referrer,
+				Property:   deadLink.Rel,
+				URL:        deadLink.URL,
+				StatusCode: deadLink.StatusCode,
+				Kind:       deadLink.Kind,
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScraper_CheckSocialMeta(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head>
+				<meta property="og:image" content="/img/missing.png">
+				<meta property="og:url" content="/">
+				<meta name="twitter:image" content="/img/card.png">
+				<meta name="description" content="/not-a-link">
+			</head><body>Home</body></html>`)
+		case "/img/card.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.DeadLinks) != 0 || result.SocialMetaIssues != nil {
+		t.Fatalf("Expected social metadata to be ignored by default, got: %+v, %+v", result.DeadLinks, result.SocialMetaIssues)
+	}
+
+	cfg.CheckSocialMeta = true
+	result, err = NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := SocialMetaIssue{Page: ts.URL, Property: "og:image", URL: ts.URL + "/img/missing.png", StatusCode: http.StatusNotFound, Kind: KindHTTPStatus}
+	if len(result.SocialMetaIssues) != 1 || result.SocialMetaIssues[0] != want {
+		t.Errorf("Expected %+v, got: %+v", want, result.SocialMetaIssues)
+	}
+	if len(result.DeadLinks) != 1 || result.DeadLinks[0].Rel != "og:image" {
+		t.Errorf("Expected the og:image among the dead links, got: %+v", result.DeadLinks)
+	}
+}
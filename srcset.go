@@ -0,0 +1,45 @@
+package main
+
+import "strings"
+
+// parseSrcset returns the candidate URLs of a srcset attribute, without their
+// width or density descriptors. URLs may contain commas, so candidates are
+// split the way the HTML standard does: a URL runs until whitespace, and
+// its descriptors until the next comma.
+func parseSrcset(srcset string) []string {
+	var urls []string
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return urls
+		}
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end < 0 {
+			end = len(rest)
+		}
+		candidate := rest[:end]
+		rest = rest[end:]
+		// A comma right after the URL ends the candidate, which then has no
+		// descriptors.
+		if trimmed := strings.TrimRight(candidate, ","); trimmed != candidate {
+			urls = append(urls, trimmed)
+			continue
+		}
+		urls = append(urls, candidate)
+
+		// Skip the descriptors. Commas within parentheses do not count.
+		depth := 0
+		i := 0
+		for ; i < len(rest); i++ {
+			if c := rest[i]; c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+			} else if c == ',' && depth == 0 {
+				break
+			}
+		}
+		rest = rest[i:]
+	}
+}
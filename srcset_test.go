@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []string
+	}{
+		{"", nil},
+		{"/a.png", []string{"/a.png"}},
+		{"/a.png 1x, /a@2x.png 2x", []string{"/a.png", "/a@2x.png"}},
+		{" /small.jpg 480w,\n/large.jpg   1080w ", []string{"/small.jpg", "/large.jpg"}},
+		{"/img/w_100,h_100/a.jpg 100w, /img/w_200,h_200/a.jpg 200w", []string{"/img/w_100,h_100/a.jpg", "/img/w_200,h_200/a.jpg"}},
+		{"/a.png,, /b.png 2x", []string{"/a.png", "/b.png"}},
+	}
+	for _, tt := range tests {
+		if got := parseSrcset(tt.srcset); !slices.Equal(got, tt.want) {
+			t.Errorf("parseSrcset(%q) = %q; want %q", tt.srcset, got, tt.want)
+		}
+	}
+}
+
+func TestStartScraper_Srcset(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<img src="/hero.jpg" srcset="/hero-480.jpg 480w, /hero-1080.jpg 1080w" alt="">
+				<picture><source srcset="/hero.webp 1x, /hero@2x.webp 2x" type="image/webp"></picture>
+			</body></html>`)
+		case "/hero-480.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	deadLinks, err := StartScraperWithConfig(ts.URL, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	got := make([]string, 0, len(deadLinks))
+	for _, deadLink := range deadLinks {
+		if deadLink.Rel != "srcset" {
+			t.Errorf("Expected %s to be reported as a srcset candidate, got rel %q", deadLink.URL, deadLink.Rel)
+		}
+		got = append(got, strings.TrimPrefix(deadLink.URL, ts.URL))
+	}
+	slices.Sort(got)
+	if want := []string{"/hero-1080.jpg", "/hero.webp", "/hero@2x.webp"}; !slices.Equal(got, want) {
+		t.Errorf("Expected dead candidates %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// etaSmoothing is the weight of the latest interval between two checked
+// URLs in the moving average used for the ETA.
+const etaSmoothing = 0.1
+
+// Stats describes the progress of a running crawl.
+type Stats struct {
+	// Checked counts the URLs checked so far.
+	Checked int
+	// Pending counts the URLs queued or being checked.
+	Pending int
+	// ETA estimates the time left to check the pending URLs, from a moving
+	// average of the completion rate. It is zero until the rate is known.
+	// Crawling pages may find new links, so it can grow; it is most
+	// meaningful once the total is known, as when checking a sitemap.
+	ETA time.Duration
+	// Workers is the size of the worker pool, and ActiveWorkers how many of
+	// them are checking a URL. Mostly idle workers mean the crawl is waiting
+	// on link discovery rather than on the network.
+	Workers       int
+	ActiveWorkers int
+	// DNSLookups counts the host name lookups of requests, and
+	// ConnectionsOpened and ConnectionsReused the connections they got. Many
+	// more opened than reused connections hint that keep-alive connections
+	// are not reused, say because the transport keeps too few idle ones.
+	DNSLookups        int
+	ConnectionsOpened int
+	ConnectionsReused int
+	// Requests counts the requests sent, retries included, and BytesRead
+	// the response body bytes read.
+	Requests  int
+	BytesRead int64
+	// RequestsPerSecond is the current request rate, from a moving average
+	// of the time between requests. It is zero until the rate is known.
+	RequestsPerSecond float64
+}
+
+// Throughput describes the average rates of a crawl.
+type Throughput struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	PagesPerSecond    float64 `json:"pages_per_second"`
+	BytesPerSecond    float64 `json:"bytes_per_second"`
+}
+
+// newThroughput averages requests sent, pages fetched and bytes read over
+// d. It is zero if d is.
+func newThroughput(requests, pages int, bytes int64, d time.Duration) Throughput {
+	if d <= 0 {
+		return Throughput{}
+	}
+	seconds := d.Seconds()
+	return Throughput{
+		RequestsPerSecond: float64(requests) / seconds,
+		PagesPerSecond:    float64(pages) / seconds,
+		BytesPerSecond:    float64(bytes) / seconds,
+	}
+}
+
+// crawlStats tracks the progress of a crawl. It is safe for concurrent use.
+type crawlStats struct {
+	// active counts the workers inside scrapePage.
+	active atomic.Int32
+	// dnsLookups, connsOpened and connsReused are counted by the trace of
+	// each request.
+	dnsLookups  atomic.Int64
+	connsOpened atomic.Int64
+	connsReused atomic.Int64
+	// bytesRead counts the body bytes read through countBody.
+	bytesRead atomic.Int64
+
+	mu      sync.Mutex
+	checked int
+	pending int
+	// last is when the latest URL was checked, or when the crawl started.
+	last time.Time
+	// interval is the moving average of the time between checked URLs.
+	interval time.Duration
+	// timed counts the URLs whose queue wait and service time are summed
+	// up in the rest.
+	timed                    int
+	queueWait, service       time.Duration
+	maxQueueWait, maxService time.Duration
+	// requests counts the requests sent, lastRequest is when the latest
+	// was, and requestInterval the moving average of the time between them.
+	requests        int
+	lastRequest     time.Time
+	requestInterval time.Duration
+}
+
+func newCrawlStats(start time.Time) *crawlStats {
+	return &crawlStats{last: start}
+}
+
+// queue records n URLs added to the frontier.
+func (s *crawlStats) queue(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending += n
+}
+
+// drop records a queued URL that will not be checked.
+func (s *crawlStats) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+}
+
+// finish records a URL checked at now.
+func (s *crawlStats) finish(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checked++
+	s.pending--
+	elapsed := now.Sub(s.last)
+	s.last = now
+	if s.interval == 0 {
+		s.interval = elapsed
+	} else {
+		s.interval = time.Duration(etaSmoothing*float64(elapsed) + (1-etaSmoothing)*float64(s.interval))
+	}
+}
+
+// traced returns ctx with hooks counting the DNS lookups and connections of
+// the request it is for.
+func (s *crawlStats) traced(ctx context.Context) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			s.dnsLookups.Add(1)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.connsReused.Add(1)
+			} else {
+				s.connsOpened.Add(1)
+			}
+		},
+	})
+}
+
+// request records a request sent at now.
+func (s *crawlStats) request(now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if !s.lastRequest.IsZero() {
+		elapsed := now.Sub(s.lastRequest)
+		if s.requestInterval == 0 {
+			s.requestInterval = elapsed
+		} else {
+			s.requestInterval = time.Duration(etaSmoothing*float64(elapsed) + (1-etaSmoothing)*float64(s.requestInterval))
+		}
+	}
+	s.lastRequest = now
+}
+
+// countBody returns body, counting the bytes read from it.
+func (s *crawlStats) countBody(body io.ReadCloser) io.ReadCloser {
+	if s == nil {
+		return body
+	}
+	return &countingBody{ReadCloser: body, n: &s.bytesRead}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// throughput averages the counts recorded over d, for pages fetched.
+func (s *crawlStats) throughput(pages int, d time.Duration) Throughput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return newThroughput(s.requests, pages, s.bytesRead.Load(), d)
+}
+
+// time records how long a checked URL waited in the frontier, and how long
+// checking it took.
+func (s *crawlStats) time(queueWait, service time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timed++
+	s.queueWait += queueWait
+	s.service += service
+	s.maxQueueWait = max(s.maxQueueWait, queueWait)
+	s.maxService = max(s.maxService, service)
+}
+
+// latencies summarizes the times recorded by time.
+func (s *crawlStats) latencies() (queueWait, service Latency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timed == 0 {
+		return Latency{}, Latency{}
+	}
+	n := time.Duration(s.timed)
+	return Latency{Mean: s.queueWait / n, Max: s.maxQueueWait}, Latency{Mean: s.service / n, Max: s.maxService}
+}
+
+func (s *crawlStats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Checked:       s.checked,
+		Pending:       s.pending,
+		ETA:           time.Duration(s.pending) * s.interval,
+		ActiveWorkers: int(s.active.Load()),
+
+		DNSLookups:        int(s.dnsLookups.Load()),
+		ConnectionsOpened: int(s.connsOpened.Load()),
+		ConnectionsReused: int(s.connsReused.Load()),
+
+		Requests:          s.requests,
+		BytesRead:         s.bytesRead.Load(),
+		RequestsPerSecond: s.requestRate(),
+	}
+}
+
+// requestRate returns the moving average of requests per second, or zero
+// until two requests were sent. s.mu must be held.
+func (s *crawlStats) requestRate() float64 {
+	if s.requestInterval <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(s.requestInterval)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawlStats_ETA(t *testing.T) {
+	start := time.Now()
+	stats := newCrawlStats(start)
+	stats.queue(11)
+	if got := stats.snapshot().ETA; got != 0 {
+		t.Errorf("Expected no ETA before any URL is checked, got %s", got)
+	}
+
+	// One URL per second, then a single slow one.
+	now := start
+	for range 10 {
+		now = now.Add(time.Second)
+		stats.finish(now)
+	}
+	if got := stats.snapshot(); got.ETA != time.Second || got.Checked != 10 || got.Pending != 1 {
+		t.Errorf("Expected 10 checked, 1 pending and a 1s ETA, got %+v", got)
+	}
+	stats.queue(1)
+	stats.finish(now.Add(11 * time.Second))
+	// The moving average only moves by a tenth of the outlier.
+	if got, want := stats.snapshot().ETA, 2*time.Second; got != want {
+		t.Errorf("Expected a smoothed ETA of %s, got %s", want, got)
+	}
+}
+
+func TestScraper_Stats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprintf(w, `<html><body>Page</body></html>`)
+			return
+		}
+		var sb strings.Builder
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	s := NewScraper(cfg)
+	done := make(chan error)
+	go func() {
+		_, err := s.Run(context.Background(), ts.URL)
+		done <- err
+	}()
+
+	var stats Stats
+	for stats = s.Stats(); stats.Checked < 3; stats = s.Stats() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats.Pending == 0 || stats.ETA <= 0 {
+		t.Errorf("Expected pending URLs and an ETA during the crawl, got %+v", stats)
+	}
+	if stats.Workers != 1 || stats.ActiveWorkers > 1 {
+		t.Errorf("Expected at most the single worker to be active, got %+v", stats)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := s.Stats(); got != (Stats{}) {
+		t.Errorf("Expected zero stats once the crawl is over, got %+v", got)
+	}
+}
+
+func TestScraper_StatsActiveWorkers(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			<-release
+			return
+		}
+		fmt.Fprintf(w, `<html><body><a href="/1">1</a><a href="/2">2</a><a href="/3">3</a></body></html>`)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 5
+	s := NewScraper(cfg)
+	done := make(chan error)
+	go func() {
+		_, err := s.Run(context.Background(), ts.URL)
+		done <- err
+	}()
+
+	// The three links are being fetched, and two workers have nothing to do.
+	deadline := time.Now().Add(5 * time.Second)
+	for stats := s.Stats(); stats.ActiveWorkers != 3 || stats.Workers != 5; stats = s.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 of 5 workers to be active, got %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
+
+func TestScraper_FrontierSize(t *testing.T) {
+	var s *Scraper
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			fmt.Fprintf(w, `<html><body>Page</body></html>`)
+			return
+		}
+		// Hold the links of the seed in the frontier.
+		s.Pause()
+		var sb strings.Builder
+		for i := range 10 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	s = NewScraper(DefaultConfig())
+	done := make(chan error)
+	go func() {
+		_, err := s.Run(context.Background(), ts.URL)
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.FrontierSize() != 10 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := s.FrontierSize(); got != 10 {
+		t.Errorf("Expected the 10 links of the seed to wait while paused, got %d", got)
+	}
+
+	s.Resume()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := s.FrontierSize(); got != 0 {
+		t.Errorf("Expected an empty frontier once the crawl is over, got %d", got)
+	}
+}
+
+func TestScraper_StatsConnections(t *testing.T) {
+	var s *Scraper
+	var mu sync.Mutex
+	var reused []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a></body></html>`)
+			return
+		}
+		mu.Lock()
+		reused = append(reused, s.Stats().ConnectionsReused)
+		mu.Unlock()
+		fmt.Fprint(w, `<html><body>Page</body></html>`)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	s = NewScraper(cfg)
+	if _, err := s.Run(context.Background(), ts.URL); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// The requests are sequential, so each one reuses the connection of the
+	// seed.
+	if want := []int{1, 2, 3}; !slices.Equal(reused, want) {
+		t.Errorf("Expected reused connection counts %v, got %v", want, reused)
+	}
+}
+
+func TestScraper_QueueWait(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprintf(w, `<html><body>Page</body></html>`)
+			return
+		}
+		var sb strings.Builder
+		for i := range 5 {
+			fmt.Fprintf(&sb, `<a href="/%d">%d</a>`, i, i)
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, sb.String())
+	}))
+	defer ts.Close()
+
+	// With a single worker, the last page waits for the four before it.
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ServiceTime.Max < 20*time.Millisecond || result.ServiceTime.Mean > result.ServiceTime.Max {
+		t.Errorf("Expected a service time of at least 20ms, got: %+v", result.ServiceTime)
+	}
+	if result.QueueWait.Max < 80*time.Millisecond || result.QueueWait.Mean > result.QueueWait.Max {
+		t.Errorf("Expected a queue wait of at least 80ms, got: %+v", result.QueueWait)
+	}
+}
+
+func TestNewThroughput(t *testing.T) {
+	got := newThroughput(30, 12, 6000, 3*time.Second)
+	want := Throughput{RequestsPerSecond: 10, PagesPerSecond: 4, BytesPerSecond: 2000}
+	if got != want {
+		t.Errorf("Expected %+v, got: %+v", want, got)
+	}
+	if got := newThroughput(30, 12, 6000, 0); got != (Throughput{}) {
+		t.Errorf("Expected no throughput without a duration, got: %+v", got)
+	}
+}
+
+func TestScraper_Throughput(t *testing.T) {
+	page := `<html><body>Page</body></html>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			fmt.Fprint(w, page)
+			return
+		}
+		fmt.Fprint(w, `<html><body><a href="/a">A</a><a href="/b">B</a></body></html>`)
+	}))
+	defer ts.Close()
+
+	// The stats are taken once the crawl is over, but before Run returns.
+	cfg := DefaultConfig()
+	var s *Scraper
+	var stats Stats
+	cfg.OnComplete = func(Result) { stats = s.Stats() }
+	s = NewScraper(cfg)
+	result, err := s.Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if stats.Requests != 3 || stats.BytesRead == 0 || stats.RequestsPerSecond <= 0 {
+		t.Errorf("Expected 3 requests, bytes read and a request rate, got: %+v", stats)
+	}
+	if len(result.Pages) != 3 {
+		t.Fatalf("Expected 3 pages, got: %+v", result.Pages)
+	}
+	if want := newThroughput(stats.Requests, len(result.Pages), stats.BytesRead, result.Duration); result.Throughput != want {
+		t.Errorf("Expected throughput %+v from the counts and duration, got: %+v", want, result.Throughput)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostThrottle spaces out requests to the same host.
+type hostThrottle struct {
+	mu sync.Mutex
+	// next holds the earliest time the next request to each host may start.
+	next map[string]time.Time
+}
+
+func newHostThrottle() *hostThrottle {
+	return &hostThrottle{next: make(map[string]time.Time)}
+}
+
+// wait reserves the next slot for host, delay after the previous one, and
+// blocks until it starts or ctx is done.
+func (t *hostThrottle) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := now
+	if next := t.next[host]; next.After(now) {
+		slot = next
+	}
+	t.next[host] = slot.Add(delay)
+	t.mu.Unlock()
+
+	return sleep(ctx, slot.Sub(now))
+}
+
+// reserve reserves the next slot for host if it starts now, like wait
+// without blocking. It reports false if host must wait.
+func (t *hostThrottle) reserve(host string, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.next[host].After(now) {
+		return false
+	}
+	t.next[host] = now.Add(delay)
+	return true
+}
+
+// readyAt returns when the next request to host may start.
+func (t *hostThrottle) readyAt(host string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next[host]
+}
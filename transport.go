@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// newTransport builds the HTTP transport used for a crawl.
+func newTransport(cfg *Config) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   cmp.Or(cfg.DialTimeout, DefaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+		// A nil resolver means the system resolver.
+		Resolver: cfg.Resolver,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = cmp.Or(cfg.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	if cfg.SOCKS5Proxy != "" {
+		dialContext, err := socks5DialContext(cfg.SOCKS5Proxy, dialer)
+		if err != nil {
+			return nil, err
+		}
+		// Requests must not also go through an HTTP proxy from the environment.
+		transport.Proxy = nil
+		transport.DialContext = dialContext
+	}
+	if len(cfg.HostOverrides) > 0 {
+		transport.DialContext = overrideHosts(cfg.HostOverrides, transport.DialContext)
+	}
+	if cfg.InsecureSkipTLS || cfg.ClientCert != nil || cfg.MinTLSVersion != 0 {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipTLS, MinVersion: cfg.MinTLSVersion}
+		if cfg.ClientCert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*cfg.ClientCert}
+		}
+	}
+	return transport, nil
+}
+
+// overrideHosts returns a dial function that connects to the address
+// overrides gives for the dialed host, keeping the port if the override has
+// none. Since only the connection is redirected, the Host header and SNI
+// still name the original host.
+func overrideHosts(overrides map[string]string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		override, ok := overrides[addr]
+		if !ok {
+			override, ok = overrides[host]
+		}
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+		if _, _, err := net.SplitHostPort(override); err != nil {
+			override = net.JoinHostPort(override, port)
+		}
+		return dial(ctx, network, override)
+	}
+}
+
+// socks5DialContext returns a dial function connecting through the SOCKS5
+// proxy at addr, given as host:port or as a socks5:// URL. Host names are
+// resolved by the proxy.
+func socks5DialContext(addr string, forward *net.Dialer) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if !strings.Contains(addr, "://") {
+		addr = "socks5://" + addr
+	}
+	proxyURL, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy: %w", err)
+	}
+	if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy: unsupported scheme %q", proxyURL.Scheme)
+	}
+	dialer, err := proxy.FromURL(proxyURL, forward)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 proxy: %w", err)
+	}
+	return dialer.(proxy.ContextDialer).DialContext, nil
+}
+
+// tlsReason reports whether err is a TLS failure, and describes it.
+func tlsReason(err error) (string, bool) {
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+
+	switch {
+	case errors.As(err, &hostnameErr):
+		return "hostname mismatch", true
+	case errors.As(err, &authorityErr):
+		if cert := authorityErr.Cert; cert != nil && bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			return "self-signed certificate", true
+		}
+		return "untrusted certificate authority", true
+	case errors.As(err, &invalidErr):
+		if invalidErr.Reason == x509.Expired {
+			return "expired certificate", true
+		}
+		return "invalid certificate", true
+	case errors.As(err, &verificationErr):
+		return "certificate verification failed", true
+	case errors.As(err, &recordErr):
+		return "server does not speak TLS", true
+	case errors.As(err, &alertErr):
+		return "handshake failure: " + alertErr.Error(), true
+	// The tls package exports no error for these: the server rejecting all
+	// the versions offered, or choosing one below the minimum.
+	case strings.Contains(err.Error(), "tls: protocol version not supported"),
+		strings.Contains(err.Error(), "tls: server selected unsupported protocol version"):
+		return "unsupported TLS version", true
+	}
+	return "", false
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS answers every A query with 127.0.0.1 and records the names that
+// were looked up.
+type fakeDNS struct {
+	mu      sync.Mutex
+	lookups []string
+}
+
+// resolver returns a resolver that talks to d instead of a real DNS server.
+func (d *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go d.serve(server)
+			return client, nil
+		},
+	}
+}
+
+// serve handles length-prefixed DNS messages, as sent over stream conns.
+func (d *fakeDNS) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err != nil || len(msg.Questions) == 0 {
+			return
+		}
+		question := msg.Questions[0]
+		d.mu.Lock()
+		d.lookups = append(d.lookups, question.Name.String())
+		d.mu.Unlock()
+
+		msg.Header.Response = true
+		msg.Header.Authoritative = true
+		if question.Type == dnsmessage.TypeA {
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}}
+		}
+		answer, err := msg.Pack()
+		if err != nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(answer))); err != nil {
+			return
+		}
+		if _, err := conn.Write(answer); err != nil {
+			return
+		}
+	}
+}
+
+func TestStartScraper_Resolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// Serve the test server under a name only the fake DNS knows about.
+	tsURL, _ := url.Parse(ts.URL)
+	seed := "http://scraper.test:" + tsURL.Port()
+
+	dns := &fakeDNS{}
+	cfg := DefaultConfig()
+	cfg.Resolver = dns.resolver()
+	deadLinks, err := StartScraperWithConfig(seed, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, seed+"/dead") == nil {
+		t.Errorf("Expected dead link not found in: %v", deadLinks)
+	}
+
+	dns.mu.Lock()
+	defer dns.mu.Unlock()
+	if !slices.Contains(dns.lookups, "scraper.test.") {
+		t.Errorf("Expected the custom resolver to look up scraper.test, got: %v", dns.lookups)
+	}
+}
+
+func TestStartScraper_TLSErrors(t *testing.T) {
+	// httptest's TLS server uses a self-signed certificate.
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>Secure</body></html>`)
+	}))
+	defer secure.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/page">secure</a></body></html>`, secure.URL)
+	}))
+	defer ts.Close()
+
+	deadLinks, err := StartScraperWithConfig(ts.URL, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	deadLink := findDeadLink(deadLinks, secure.URL+"/page")
+	if deadLink == nil {
+		t.Fatalf("Expected TLS failure to be reported, got: %v", deadLinks)
+	}
+	if deadLink.Kind != KindTLSError {
+		t.Errorf("Expected kind %q, got %q", KindTLSError, deadLink.Kind)
+	}
+	if deadLink.Reason != "self-signed certificate" {
+		t.Errorf("Expected reason %q, got %q", "self-signed certificate", deadLink.Reason)
+	}
+
+	cfg := DefaultConfig()
+	cfg.InsecureSkipTLS = true
+	deadLinks, err = StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deadLinks) != 0 {
+		t.Errorf("Expected no dead links when skipping verification, got: %v", deadLinks)
+	}
+}
+
+func TestTLSReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}, "hostname mismatch"},
+		{x509.CertificateInvalidError{Reason: x509.Expired}, "expired certificate"},
+		{x509.UnknownAuthorityError{}, "untrusted certificate authority"},
+	}
+	for _, tt := range tests {
+		// Errors arrive wrapped by the HTTP client.
+		err := &url.Error{Op: "Get", URL: "https://example.com", Err: &tls.CertificateVerificationError{Err: tt.err}}
+		got, ok := tlsReason(err)
+		if !ok || got != tt.want {
+			t.Errorf("tlsReason(%v) = %q, %v; want %q", tt.err, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := tlsReason(errors.New("connection refused")); ok {
+		t.Errorf("Expected a plain network error not to be a TLS error")
+	}
+}
+
+func TestStartScraper_MinTLSVersion(t *testing.T) {
+	// The server cannot negotiate anything above TLS 1.2.
+	old := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body>Old</body></html>`)
+	}))
+	old.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	old.StartTLS()
+	defer old.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/page">old</a></body></html>`, old.URL)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.InsecureSkipTLS = true
+	if deadLinks, err := StartScraperWithConfig(ts.URL, cfg); err != nil || len(deadLinks) != 0 {
+		t.Fatalf("Expected TLS 1.2 to be accepted by default, got: %v, %v", deadLinks, err)
+	}
+
+	cfg.MinTLSVersion = tls.VersionTLS13
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	deadLink := findDeadLink(deadLinks, old.URL+"/page")
+	if deadLink == nil {
+		t.Fatalf("Expected the TLS 1.2 server to be reported, got: %v", deadLinks)
+	}
+	if deadLink.Kind != KindTLSError || deadLink.Reason != "unsupported TLS version" {
+		t.Errorf("Expected kind %q with reason %q, got: %+v", KindTLSError, "unsupported TLS version", deadLink)
+	}
+}
+
+// socks5Server is a minimal SOCKS5 proxy supporting unauthenticated CONNECT.
+// It records the addresses it was asked to connect to.
+type socks5Server struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	targets []string
+}
+
+func newSOCKS5Server(t *testing.T) *socks5Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: version, method count, methods. Reply with "no auth".
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, head[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: version, command, reserved, address type.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port)))
+
+	s.mu.Lock()
+	s.targets = append(s.targets, target)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func TestStartScraper_SOCKS5Proxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	proxyServer := newSOCKS5Server(t)
+	defer proxyServer.ln.Close()
+
+	cfg := DefaultConfig()
+	cfg.SOCKS5Proxy = proxyServer.ln.Addr().String()
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, ts.URL+"/dead") == nil {
+		t.Errorf("Expected dead link through the proxy, got: %v", deadLinks)
+	}
+
+	proxyServer.mu.Lock()
+	targets := proxyServer.targets
+	proxyServer.mu.Unlock()
+	if !slices.Contains(targets, ts.Listener.Addr().String()) {
+		t.Errorf("Expected connections to go through the proxy, got targets: %v", targets)
+	}
+
+	cfg.SOCKS5Proxy = "http://" + proxyServer.ln.Addr().String()
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err == nil {
+		t.Errorf("Expected an error for a non-SOCKS5 proxy URL")
+	}
+}
+
+func TestStartScraper_HostOverrides(t *testing.T) {
+	var mu sync.Mutex
+	hosts := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="/dead">Dead</a></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.HostOverrides = map[string]string{"staging.example.com": ts.Listener.Addr().String()}
+	deadLinks, err := StartScraperWithConfig("http://staging.example.com/", cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if findDeadLink(deadLinks, "http://staging.example.com/dead") == nil {
+		t.Errorf("Expected dead link on the overridden host, got: %v", deadLinks)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hosts) != 2 || hosts[0] != "staging.example.com" || hosts[1] != "staging.example.com" {
+		t.Errorf("Expected the original Host header to be sent, got: %v", hosts)
+	}
+}
+
+func TestStartScraper_ReusesConnections(t *testing.T) {
+	filler := strings.Repeat("x", 16<<10)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body>
+				<a href="/missing">Missing</a>
+				<a href="/report.pdf">Report</a>
+				<a href="/page">Page</a>
+				<a href="/redirect">Redirect</a>
+			</body></html>`)
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, filler)
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			fmt.Fprintf(w, "<html><body>%s</body></html>", filler)
+		default:
+			http.Error(w, filler, http.StatusNotFound)
+		}
+	}))
+	var conns atomic.Int32
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Workers = 1
+	if _, err := StartScraperWithConfig(ts.URL, cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("Expected every request to reuse one connection, got %d connections", got)
+	}
+}
+
+func TestStartScraper_StepTimeouts(t *testing.T) {
+	// The handshake with this host never completes.
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	go func() {
+		for {
+			conn, err := stalled.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body><a href="https://%s/">Stalled</a><a href="/slow">Slow</a></body></html>`, stalled.Addr())
+		case "/slow":
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Timeout = time.Minute
+	cfg.TLSHandshakeTimeout = 100 * time.Millisecond
+	cfg.ResponseHeaderTimeout = 100 * time.Millisecond
+	start := time.Now()
+	deadLinks, err := StartScraperWithConfig(ts.URL, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the step timeouts to apply, took %s", elapsed)
+	}
+	if d := findDeadLink(deadLinks, "https://"+stalled.Addr().String()+"/"); d == nil || !strings.Contains(d.Error, "TLS handshake timeout") {
+		t.Errorf("Expected a TLS handshake timeout, got: %+v", deadLinks)
+	}
+	// Like with Timeout, a slow answer does not make a link dead.
+	if d := findDeadLink(deadLinks, ts.URL+"/slow"); d != nil {
+		t.Errorf("Expected the slow page to time out, got: %+v", d)
+	}
+}
+
+func TestStartScraper_ClientCert(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "scraper"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>Internal</body></html>`)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.InsecureSkipTLS = true
+	if _, err := NewScraper(cfg).Run(context.Background(), ts.URL); !errors.Is(err, ErrSeedUnreachable) {
+		t.Errorf("Expected the server to reject the crawl without a certificate, got: %v", err)
+	}
+
+	cfg.ClientCert = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	if _, err := NewScraper(cfg).Run(context.Background(), ts.URL); err != nil {
+		t.Errorf("Expected the certificate to be accepted, got: %v", err)
+	}
+}
+
+func TestStartScraper_UpgradeToHTTPS(t *testing.T) {
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><body>Secure</body></html>`)
+	}))
+	defer secure.Close()
+	var plainPaths []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		plainPaths = append(plainPaths, r.URL.Path)
+		mu.Unlock()
+		// The page is also linked to over https, and crawled once.
+		fmt.Fprintf(w, `<html><body><a href="/page">Page</a><a href="https://%s/page">Page</a></body></html>`, r.Host)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.UpgradeToHTTPS = true
+	cfg.InsecureSkipTLS = true
+	// Both servers stand for the same host, one port for each scheme.
+	secureURL, _ := url.Parse(secure.URL)
+	cfg.RewriteURL = func(u *url.URL) *url.URL {
+		if u.Scheme == "https" {
+			u.Host = secureURL.Host
+		}
+		return u
+	}
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var pages []string
+	for _, page := range result.Pages {
+		pages = append(pages, page.URL)
+	}
+	slices.Sort(pages)
+	upgraded := "https://" + strings.TrimPrefix(ts.URL, "http://") + "/page"
+	if want := []string{ts.URL + "/", upgraded}; !slices.Equal(pages, want) {
+		t.Errorf("Expected pages %v, got %v", want, pages)
+	}
+	if want := []string{"/"}; !slices.Equal(plainPaths, want) {
+		t.Errorf("Expected only the seed, with no https version, to be fetched over http, got: %v", plainPaths)
+	}
+}
+
+func TestStartScraper_UpgradeToHTTPSProbe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a href="/a">A</a><a href="/b">B</a><a href="/c">C</a></body></html>`)
+	}))
+	defer ts.Close()
+
+	// Nothing listens for https, which is probed once, without retries.
+	cfg := DefaultConfig()
+	cfg.UpgradeToHTTPS = true
+	cfg.MaxRetries = 3
+	cfg.RetryBackoff = time.Millisecond
+	var s *Scraper
+	var stats Stats
+	cfg.OnComplete = func(Result) { stats = s.Stats() }
+	s = NewScraper(cfg)
+	result, err := s.Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.DeadLinks) != 0 {
+		t.Errorf("Expected the http versions to be crawled, got: %+v", result.DeadLinks)
+	}
+	if stats.Requests != 5 {
+		t.Errorf("Expected one https probe and 4 http requests, got %d requests", stats.Requests)
+	}
+}
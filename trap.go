@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// templatePlaceholder replaces numeric segments in a path template.
+const templatePlaceholder = "{n}"
+
+// trapDetector counts visits per path template, to stop crawler traps such
+// as unbounded pagination or calendars. It is only used by the link handler.
+type trapDetector struct {
+	maxHits int
+	hits    map[string]int
+}
+
+func newTrapDetector(maxHits int) *trapDetector {
+	return &trapDetector{maxHits: maxHits, hits: make(map[string]int)}
+}
+
+// allow records a visit to u and reports whether it should be crawled. The
+// first time a template goes over the limit it is also reported as a trap.
+func (d *trapDetector) allow(u *url.URL) (allowed bool, trap string) {
+	if d == nil {
+		return true, ""
+	}
+	template := pathTemplate(u)
+	d.hits[template]++
+	switch hits := d.hits[template]; {
+	case hits <= d.maxHits:
+		return true, ""
+	case hits == d.maxHits+1:
+		return false, template
+	}
+	return false, ""
+}
+
+// pathTemplate returns the host and path of u with numeric segments replaced
+// by a placeholder, e.g. host/calendar/{n}/{n}. Query strings are already
+// dropped from crawled URLs.
+func pathTemplate(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if isNumeric(segment) {
+			segments[i] = templatePlaceholder
+		}
+	}
+	return strings.ToLower(u.Host) + strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/calendar/2025/01", "example.com/calendar/{n}/{n}"},
+		{"http://example.com/page/3/", "example.com/page/{n}/"},
+		{"http://example.com/v2/about", "example.com/v2/about"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pathTemplate(u); got != tt.want {
+			t.Errorf("pathTemplate(%q) = %q; want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestRun_CalendarTrap(t *testing.T) {
+	// Every month links to the next one, forever.
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			fmt.Fprintf(w, `<html><body><a href="/calendar/1">Calendar</a><a href="/about">About</a></body></html>`)
+		case strings.HasPrefix(r.URL.Path, "/calendar/"):
+			hits.Add(1)
+			month, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/calendar/"))
+			fmt.Fprintf(w, `<html><body><a href="/calendar/%d">Next</a></body></html>`, month+1)
+		case r.URL.Path == "/about":
+			fmt.Fprintf(w, `<html><body>About</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxTemplateHits = 5
+	result, err := NewScraper(cfg).Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := hits.Load(); got != 5 {
+		t.Errorf("Expected 5 pages of the trap to be crawled, got %d", got)
+	}
+	host := strings.TrimPrefix(ts.URL, "http://")
+	if want := host + "/calendar/{n}"; !slices.Equal(result.Traps, []string{want}) {
+		t.Errorf("Expected trap %q to be reported, got: %v", want, result.Traps)
+	}
+	if !slices.ContainsFunc(result.Pages, func(p Page) bool { return p.URL == ts.URL+"/about" }) {
+		t.Errorf("Expected other pages to still be crawled, got: %v", result.Pages)
+	}
+}
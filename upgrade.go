@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+)
+
+// httpsVersion returns the https version of the http URL u, dropping the
+// default http port.
+func httpsVersion(u *url.URL) *url.URL {
+	upgraded := *u
+	upgraded.Scheme = "https"
+	if upgraded.Port() == "80" {
+		upgraded.Host = upgraded.Hostname()
+	}
+	return &upgraded
+}
+
+// upgradable reports whether u is tried over https first, for
+// Config.UpgradeToHTTPS.
+func (data *WorkerData) upgradable(u *url.URL) bool {
+	return data.cfg.UpgradeToHTTPS && u.Scheme == "http" && data.inScope(u)
+}
+
+// httpsHosts remembers which hosts answered over https, so that the https
+// version of their URLs is only probed once per host.
+type httpsHosts struct {
+	mu    sync.Mutex
+	hosts map[string]bool
+}
+
+func newHTTPSHosts() *httpsHosts {
+	return &httpsHosts{hosts: make(map[string]bool)}
+}
+
+// lookup reports whether host answered over https, if it was probed.
+func (h *httpsHosts) lookup(host string) (supported, probed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	supported, probed = h.hosts[host]
+	return supported, probed
+}
+
+// record sets whether host answered over https.
+func (h *httpsHosts) record(host string, supported bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hosts[host] = supported
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// watchdog fires when no URL has been checked for a while.
+type watchdog struct {
+	timeout time.Duration
+	kick    chan struct{}
+}
+
+func newWatchdog(timeout time.Duration) *watchdog {
+	return &watchdog{timeout: timeout, kick: make(chan struct{}, 1)}
+}
+
+// reset records progress, restarting the countdown.
+func (w *watchdog) reset() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// run calls fire once timeout passes without a reset, unless paused reports
+// true, in which case the countdown restarts. It returns once it fired or
+// ctx is done.
+func (w *watchdog) run(ctx context.Context, paused func() bool, fire func()) {
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.kick:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(w.timeout)
+		case <-timer.C:
+			if !paused() {
+				fire()
+				return
+			}
+			timer.Reset(w.timeout)
+		}
+	}
+}